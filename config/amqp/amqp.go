@@ -2,7 +2,9 @@ package amqp
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"CommandHandler/utils"
@@ -10,26 +12,55 @@ import (
 )
 
 type Client struct {
-	log  *utils.Logger
-	conn *streadway.Connection
-	ch   *streadway.Channel
+	log *utils.Logger
+	url string
+
+	RetryDelay time.Duration // TTL retry queue (default 10s)
+	Topology   Topology      // nama exchange/queue + argumen queue (default: DefaultTopology)
+
+	onConnect []func(conn *streadway.Connection) error
+
+	mu       sync.RWMutex
+	conn     *streadway.Connection
+	ch       *streadway.Channel
+	queue    string // queue command store ini (di-set oleh SetupRepairQueue)
+	chClosed bool   // channel consumer sudah ditutup broker
+
+	// channel confirm-mode khusus publish retry/DLQ/requeue (lihat publishConfirmed)
+	confirmMu   sync.Mutex
+	confirmCh   *streadway.Channel
+	confirmConn *streadway.Connection
+	confirms    <-chan streadway.Confirmation
+	returns     <-chan streadway.Return
 }
 
-func NewClient(log *utils.Logger) *Client { return &Client{log: log} }
+func NewClient(log *utils.Logger) *Client { return &Client{log: log, Topology: DefaultTopology()} }
+
+// OnConnect: fn dipanggil setiap kali koneksi baru terbentuk (connect awal + reconnect),
+// mis. untuk membuka channel publisher sendiri. Daftarkan sebelum Connect.
+func (c *Client) OnConnect(fn func(conn *streadway.Connection) error) {
+	c.onConnect = append(c.onConnect, fn)
+}
 
 // Connect dengan exponential backoff ringan
 func (c *Client) Connect(ctx context.Context, url string) error {
+	c.url = url
+	return c.dial(ctx, 8)
+}
+
+// dial: maxAttempts <= 0 → coba terus sampai ctx selesai.
+func (c *Client) dial(ctx context.Context, maxAttempts int) error {
 	var (
 		conn *streadway.Connection
 		err  error
 	)
-	for attempt := 0; attempt < 8; attempt++ {
-		conn, err = streadway.Dial(url)
+	for attempt := 0; maxAttempts <= 0 || attempt < maxAttempts; attempt++ {
+		conn, err = streadway.Dial(c.url)
 		if err == nil {
 			break
 		}
-		// backoff: 200ms, 400ms, 800ms, ...
-		delay := time.Duration(1<<uint(attempt)) * 200 * time.Millisecond
+		delay := backoff(attempt)
+		c.log.Warn("RabbitMQ dial failed, retrying", "attempt", attempt+1, "in", delay, "err", err)
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
@@ -39,17 +70,47 @@ func (c *Client) Connect(ctx context.Context, url string) error {
 	if err != nil {
 		return err
 	}
+	if err := c.openChannel(conn); err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	for _, fn := range c.onConnect {
+		if err := fn(conn); err != nil {
+			c.log.Fail("on-connect hook failed", "err", err)
+		}
+	}
+	return nil
+}
+
+// openChannel: buka channel consumer baru di conn dan jadikan channel aktif.
+func (c *Client) openChannel(conn *streadway.Connection) error {
 	ch, err := conn.Channel()
 	if err != nil {
-		_ = conn.Close()
 		return err
 	}
+
+	c.mu.Lock()
 	c.conn = conn
 	c.ch = ch
+	c.chClosed = false
+	c.mu.Unlock()
+
+	closed := ch.NotifyClose(make(chan *streadway.Error, 1))
+	go func() {
+		<-closed
+		c.mu.Lock()
+		if c.ch == ch {
+			c.chClosed = true
+		}
+		c.mu.Unlock()
+	}()
 	return nil
 }
 
 func (c *Client) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.ch != nil {
 		_ = c.ch.Close()
 	}
@@ -58,41 +119,188 @@ func (c *Client) Close() {
 	}
 }
 
+// backoff: 200ms, 400ms, 800ms, ... maks 30s
+func backoff(attempt int) time.Duration {
+	if attempt >= 8 {
+		return 30 * time.Second
+	}
+	return time.Duration(1<<uint(attempt)) * 200 * time.Millisecond
+}
+
+// stableSession: sesi yang jalan minimal selama ini dianggap sehat (hitungan gagal beruntun di-reset).
+const stableSession = 30 * time.Second
+
+// Serve menjalankan consume dengan channel aktif. Kalau koneksi/channel putus (NotifyClose)
+// atau consume berhenti sendiri, reconnect dengan backoff, ulangi SetupRepairQueue, lalu consume lagi.
+// Setup/sesi yang gagal beruntun (broker hidup tapi declare/consume error) ditunda makin lama,
+// supaya tidak membanjiri broker dan log. Hanya berhenti kalau ctx selesai.
+func (c *Client) Serve(ctx context.Context, storeID string, consume func(ctx context.Context, ch *streadway.Channel, queue string) error) error {
+	failures := 0
+	for {
+		started := time.Now()
+		queue, key, err := c.SetupRepairQueue(ctx, storeID)
+		setupOK := err == nil
+		if !setupOK {
+			c.log.Fail("Queue binding failed", "err", err)
+		} else {
+			c.log.OK("Queue bound", "queue", queue, "key", key)
+			err = c.consumeUntilClosed(ctx, queue, consume)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var delay time.Duration
+		if !setupOK || time.Since(started) < stableSession {
+			delay = backoff(failures)
+			failures++
+		} else {
+			failures = 0
+		}
+		c.log.Warn("RabbitMQ session ended, reconnecting", "err", err, "in", delay, "failures", failures)
+
+		c.Close()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if err := c.dial(ctx, 0); err != nil {
+			return err
+		}
+		c.log.OK("RabbitMQ reconnected")
+	}
+}
+
+// consumeUntilClosed: jalankan consume, batalkan ctx-nya kalau connection/channel ditutup broker.
+func (c *Client) consumeUntilClosed(ctx context.Context, queue string, consume func(ctx context.Context, ch *streadway.Channel, queue string) error) error {
+	c.mu.RLock()
+	conn, ch := c.conn, c.ch
+	c.mu.RUnlock()
+
+	connClosed := conn.NotifyClose(make(chan *streadway.Error, 1))
+	chClosed := ch.NotifyClose(make(chan *streadway.Error, 1))
+
+	sessCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	closed := make(chan error, 1)
+	go func() {
+		var reason *streadway.Error
+		select {
+		case reason = <-connClosed:
+		case reason = <-chClosed:
+		case <-sessCtx.Done():
+			return
+		}
+		if reason != nil {
+			closed <- reason
+		} else {
+			closed <- errors.New("amqp closed")
+		}
+		cancel()
+	}()
+
+	err := consume(sessCtx, ch, queue)
+	select {
+	case reason := <-closed:
+		return fmt.Errorf("amqp closed: %w", reason)
+	default:
+	}
+	if err == nil {
+		err = errors.New("consumer stopped")
+	}
+	return err
+}
+
 func (c *Client) DeclareExchange(ctx context.Context, name, kind string, durable bool) error {
-	return c.ch.ExchangeDeclare(name, kind, durable, false, false, false, nil)
+	return c.Channel().ExchangeDeclare(name, kind, durable, false, false, false, nil)
 }
 
 func (c *Client) DeclareQueue(ctx context.Context, name string) error {
-	_, err := c.ch.QueueDeclare(name, true, false, false, false, nil)
+	return c.DeclareQueueWithArgs(ctx, name, nil)
+}
+
+// DeclareQueueWithArgs: catatan, RabbitMQ menolak (PRECONDITION_FAILED) kalau queue sudah ada
+// dengan argumen berbeda, dan channel-nya ikut ditutup. Untuk queue command lihat declareCommandQueue.
+func (c *Client) DeclareQueueWithArgs(ctx context.Context, name string, args streadway.Table) error {
+	_, err := c.Channel().QueueDeclare(name, true, false, false, false, args)
 	return err
 }
 
 func (c *Client) BindQueue(ctx context.Context, queue, exchange, routingKey string) error {
-	return c.ch.QueueBind(queue, routingKey, exchange, false, nil)
+	return c.Channel().QueueBind(queue, routingKey, exchange, false, nil)
 }
 
 func (c *Client) SetupRepairQueue(ctx context.Context, storeID string) (queueName, routingKey string, err error) {
-	const (
-		exchange = "REPAIR_TRANSACTION"
-		exchKind = "topic"
-	)
+	t := c.Topology
+	exchange := t.ExchangeName()
+	queueName = t.QueueName(storeID)
+	routingKey = t.RoutingKeyFor(storeID)
 
-	queueName = fmt.Sprintf("CLIENT_%s", storeID)
-	routingKey = fmt.Sprintf("STORE.%s.COMMAND", storeID)
-
-	if err = c.DeclareExchange(ctx, exchange, exchKind, true); err != nil {
+	if err = c.DeclareExchange(ctx, exchange, t.ExchangeKind, true); err != nil {
+		return "", "", err
+	}
+	if err = c.setupDeadLetter(ctx, queueName); err != nil {
+		return "", "", err
+	}
+	if err = c.setupRetry(ctx, queueName, exchange, routingKey); err != nil {
 		return "", "", err
 	}
-	if err = c.DeclareQueue(ctx, queueName); err != nil {
+	if err = c.declareCommandQueue(ctx, queueName); err != nil {
 		return "", "", err
 	}
 	if err = c.BindQueue(ctx, queueName, exchange, routingKey); err != nil {
 		return "", "", err
 	}
 
+	c.mu.Lock()
+	c.queue = queueName
+	c.mu.Unlock()
 	return queueName, routingKey, nil
 }
 
+// declareCommandQueue: declare queue command dengan argumen topology. Queue yang sudah ada dari versi
+// lama (tanpa x-dead-letter-exchange dll.) ditolak broker dengan 406; jangan di-loop (Serve akan
+// reconnect terus) → buka channel baru dan pakai queue lama apa adanya lewat passive declare.
+// Migrasi: hapus queue saat kosong supaya dibuat ulang, atau pasang dead-letter-exchange lewat policy broker.
+func (c *Client) declareCommandQueue(ctx context.Context, queue string) error {
+	err := c.DeclareQueueWithArgs(ctx, queue, c.Topology.commandQueueArgs(queue))
+	var amqpErr *streadway.Error
+	if err == nil || !errors.As(err, &amqpErr) || amqpErr.Code != streadway.PreconditionFailed {
+		return err
+	}
+
+	c.mu.RLock()
+	conn := c.conn
+	c.mu.RUnlock()
+	if err := c.openChannel(conn); err != nil {
+		return fmt.Errorf("reopen channel after %s: %w", amqpErr.Reason, err)
+	}
+	if _, err := c.Channel().QueueDeclarePassive(queue, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("queue %s: arguments differ (%s) and passive declare failed: %w", queue, amqpErr.Reason, err)
+	}
+	c.log.Fail("Queue exists with different arguments, consuming it as-is; dead-letter/TTL/limit args NOT applied. Delete the queue or set a broker policy to migrate",
+		"queue", queue, "reason", amqpErr.Reason)
+	return nil
+}
+
+// Ready: nil kalau koneksi dan channel consumer terbuka (untuk /readyz).
+func (c *Client) Ready() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.conn == nil || c.conn.IsClosed() {
+		return errors.New("amqp connection closed")
+	}
+	if c.ch == nil || c.chClosed {
+		return errors.New("amqp channel closed")
+	}
+	return nil
+}
+
+// Channel: channel aktif saat ini (berganti setelah reconnect, jadi jangan di-cache).
 func (c *Client) Channel() *streadway.Channel {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.ch
 }
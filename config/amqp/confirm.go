@@ -0,0 +1,88 @@
+package amqp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	streadway "github.com/streadway/amqp"
+)
+
+const confirmTimeout = 5 * time.Second
+
+// publishConfirmed: publish lewat channel confirm-mode khusus (terpisah dari channel consumer) dan
+// tunggu ack broker, untuk pesan yang baru boleh di-ack aslinya setelah salinannya pasti tersimpan
+// (retry, DLQ, requeue DLQ). Jarang terjadi, jadi publish + tunggu confirm cukup diserialisasi dengan confirmMu.
+func (c *Client) publishConfirmed(exchange, routingKey string, msg streadway.Publishing) error {
+	c.confirmMu.Lock()
+	defer c.confirmMu.Unlock()
+
+	c.mu.RLock()
+	conn := c.conn
+	c.mu.RUnlock()
+	if conn == nil {
+		return errors.New("amqp not connected")
+	}
+	// channel lama milik koneksi sebelum reconnect → buka ulang
+	if c.confirmCh == nil || c.confirmConn != conn {
+		if err := c.openConfirmChannel(conn); err != nil {
+			return err
+		}
+	}
+	reset := func(err error) error {
+		_ = c.confirmCh.Close()
+		c.confirmCh = nil
+		return err
+	}
+
+	// mandatory: tujuan yang tidak ada → basic.return, bukan di-ack diam-diam
+	if err := c.confirmCh.Publish(exchange, routingKey, true, false, msg); err != nil {
+		return reset(err)
+	}
+
+	timer := time.NewTimer(confirmTimeout)
+	defer timer.Stop()
+	returns := c.returns
+	returned := ""
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			returned = r.ReplyText // selalu datang sebelum ack pesan yang sama
+		case conf, ok := <-c.confirms:
+			if !ok {
+				return reset(errors.New("confirm channel closed"))
+			}
+			switch {
+			case returned != "":
+				return fmt.Errorf("unroutable: %s", returned)
+			case !conf.Ack:
+				return errors.New("publish nacked")
+			}
+			return nil
+		case <-timer.C:
+			// confirm telat jangan sampai tertukar dengan publish berikutnya → tutup channel
+			return reset(errors.New("publish confirm timeout"))
+		}
+	}
+}
+
+// openConfirmChannel: caller pegang confirmMu.
+func (c *Client) openConfirmChannel(conn *streadway.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	if err := ch.Confirm(false); err != nil {
+		_ = ch.Close()
+		return fmt.Errorf("publisher confirms not supported: %w", err)
+	}
+	c.confirmCh = ch
+	c.confirmConn = conn
+	c.confirms = ch.NotifyPublish(make(chan streadway.Confirmation, 1))
+	c.returns = ch.NotifyReturn(make(chan streadway.Return, 1))
+	return nil
+}
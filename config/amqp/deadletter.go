@@ -0,0 +1,220 @@
+package amqp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"CommandHandler/types"
+	streadway "github.com/streadway/amqp"
+)
+
+// Dead-letter: pesan yang ditolak consumer (JSON rusak, panic, dll) dipindah ke DLQ per store,
+// lengkap dengan alasan di header, supaya bisa dicek lalu di-requeue lewat command.
+const (
+	deadLetterKind = "direct"
+
+	HeaderFailureReason      = "x-failure-reason"
+	HeaderFailureStack       = "x-failure-stack"
+	HeaderFailedAt           = "x-failed-at"
+	HeaderOriginalExchange   = "x-original-exchange"
+	HeaderOriginalRoutingKey = "x-original-routing-key"
+)
+
+func deadLetterQueue(queue string) string { return queue + ".DLQ" }
+
+// setupDeadLetter: declare DLX + DLQ, binding pakai nama queue asal sebagai routing key.
+func (c *Client) setupDeadLetter(ctx context.Context, queue string) error {
+	dlx := c.Topology.DeadLetterExchangeName()
+	if err := c.DeclareExchange(ctx, dlx, deadLetterKind, true); err != nil {
+		return err
+	}
+	if err := c.DeclareQueueWithArgs(ctx, deadLetterQueue(queue), c.Topology.queueTypeArgs()); err != nil {
+		return err
+	}
+	return c.BindQueue(ctx, deadLetterQueue(queue), dlx, queue)
+}
+
+// Quarantine memindah pesan ke DLQ dengan header alasan (+ stack untuk panic): publish ke DLX dengan
+// confirm dulu, baru ack pesan asli. Kalau publish gagal, fallback Nack tanpa requeue → tetap masuk DLQ
+// lewat x-dead-letter-exchange (hanya tanpa header alasan; dibuang kalau QueueArgs.DisableDeadLetter).
+func (c *Client) Quarantine(queue string, d streadway.Delivery, reason, stack string) error {
+	headers := streadway.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[HeaderFailureReason] = reason
+	headers[HeaderFailedAt] = time.Now().Format(time.RFC3339)
+	headers[HeaderOriginalExchange] = d.Exchange
+	headers[HeaderOriginalRoutingKey] = d.RoutingKey
+	if stack != "" {
+		headers[HeaderFailureStack] = stack
+	}
+
+	err := c.publishConfirmed(c.Topology.DeadLetterExchangeName(), queue, streadway.Publishing{
+		Headers:       headers,
+		ContentType:   d.ContentType,
+		MessageId:     d.MessageId,
+		CorrelationId: d.CorrelationId,
+		Timestamp:     d.Timestamp,
+		DeliveryMode:  streadway.Persistent,
+		Body:          d.Body,
+	})
+	if err != nil {
+		_ = d.Nack(false, false)
+		return fmt.Errorf("publish to dead-letter failed: %w", err)
+	}
+	return d.Ack(false)
+}
+
+// ListDeadLetters: intip maksimal limit pesan di DLQ tanpa menghapusnya.
+func (c *Client) ListDeadLetters(ctx context.Context, limit int) ([]types.DeadLetter, error) {
+	out, _, err := c.drainDeadLetters(ctx, limit, nil, false)
+	return out, err
+}
+
+// RequeueDeadLetters: kirim balik pesan DLQ ke exchange/routing key asal.
+// ticketIDs kosong → semua (maksimal limit). Pesan yang tujuannya tidak diketahui atau gagal di-publish
+// tetap di DLQ dan dikembalikan di skipped (dengan Error), batch tetap lanjut.
+func (c *Client) RequeueDeadLetters(ctx context.Context, limit int, ticketIDs []string) (requeued, skipped []types.DeadLetter, err error) {
+	return c.drainDeadLetters(ctx, limit, ticketIDs, true)
+}
+
+func (c *Client) drainDeadLetters(ctx context.Context, limit int, ticketIDs []string, requeue bool) (out, skipped []types.DeadLetter, err error) {
+	c.mu.RLock()
+	conn, queue := c.conn, c.queue
+	c.mu.RUnlock()
+	if queue == "" {
+		return nil, nil, fmt.Errorf("queue not set up yet")
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	want := map[string]bool{}
+	for _, id := range ticketIDs {
+		want[id] = true
+	}
+
+	// channel sendiri: pesan yang belum di-ack otomatis kembali ke DLQ saat channel ditutup
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer ch.Close()
+
+	var held []streadway.Delivery
+	for seen := 0; seen < limit && ctx.Err() == nil; seen++ {
+		d, ok, err := ch.Get(deadLetterQueue(queue), false)
+		if err != nil {
+			return out, skipped, err
+		}
+		if !ok {
+			break
+		}
+
+		dl := toDeadLetter(d)
+		if !requeue {
+			held = append(held, d)
+			out = append(out, dl)
+			continue
+		}
+		if len(want) > 0 && !want[dl.TicketID] {
+			held = append(held, d)
+			continue
+		}
+		if err := c.republish(d); err != nil {
+			held = append(held, d)
+			dl.Error = err.Error()
+			skipped = append(skipped, dl)
+			continue
+		}
+		_ = d.Ack(false)
+		out = append(out, dl)
+	}
+
+	// sisanya dikembalikan ke DLQ
+	for _, d := range held {
+		_ = d.Nack(false, true)
+	}
+	return out, skipped, nil
+}
+
+// republish: publish ulang (dengan confirm) ke tujuan asal; pesan DLQ baru di-ack setelah broker konfirmasi.
+func (c *Client) republish(d streadway.Delivery) error {
+	exchange, routingKey, ok := origin(d)
+	if !ok {
+		return fmt.Errorf("unknown destination: no %s header or x-death entry", HeaderOriginalRoutingKey)
+	}
+
+	headers := streadway.Table{}
+	for k, v := range d.Headers {
+		switch k {
+		case HeaderFailureReason, HeaderFailureStack, HeaderFailedAt, HeaderOriginalExchange, HeaderOriginalRoutingKey, "x-death":
+		default:
+			headers[k] = v
+		}
+	}
+	return c.publishConfirmed(exchange, routingKey, streadway.Publishing{
+		Headers:       headers,
+		ContentType:   d.ContentType,
+		MessageId:     d.MessageId,
+		CorrelationId: d.CorrelationId,
+		Timestamp:     d.Timestamp,
+		DeliveryMode:  streadway.Persistent,
+		Body:          d.Body,
+	})
+}
+
+// origin: exchange/routing key asal pesan DLQ. Header x-original-* ditulis Quarantine; pesan yang
+// di-dead-letter broker (Nack fallback, TTL, max-length) hanya punya x-death (entry [0] = paling baru).
+func origin(d streadway.Delivery) (exchange, routingKey string, ok bool) {
+	if rk, _ := d.Headers[HeaderOriginalRoutingKey].(string); rk != "" {
+		exchange, _ = d.Headers[HeaderOriginalExchange].(string)
+		return exchange, rk, true
+	}
+	death := firstDeath(d)
+	exchange, _ = death["exchange"].(string)
+	keys, _ := death["routing-keys"].([]interface{})
+	if len(keys) == 0 {
+		return "", "", false
+	}
+	routingKey, _ = keys[0].(string)
+	return exchange, routingKey, routingKey != ""
+}
+
+// firstDeath: entry x-death paling baru (nil kalau tidak ada).
+func firstDeath(d streadway.Delivery) streadway.Table {
+	deaths, _ := d.Headers["x-death"].([]interface{})
+	if len(deaths) == 0 {
+		return nil
+	}
+	death, _ := deaths[0].(streadway.Table)
+	return death
+}
+
+func toDeadLetter(d streadway.Delivery) types.DeadLetter {
+	dl := types.DeadLetter{Body: string(d.Body)}
+	dl.Reason, _ = d.Headers[HeaderFailureReason].(string)
+	dl.Stack, _ = d.Headers[HeaderFailureStack].(string)
+	dl.FailedAt, _ = d.Headers[HeaderFailedAt].(string)
+	_, dl.RoutingKey, _ = origin(d)
+	if dl.Reason == "" {
+		dl.Reason, _ = firstDeath(d)["reason"].(string) // rejected / expired / maxlen
+	}
+
+	// ticketId best-effort (body bisa saja JSON rusak)
+	var env struct {
+		TicketID string `json:"ticketId"`
+		Data     struct {
+			TicketID string `json:"ticketId"`
+		} `json:"data"`
+	}
+	if json.Unmarshal(d.Body, &env) == nil {
+		dl.TicketID = env.TicketID
+		if dl.TicketID == "" {
+			dl.TicketID = env.Data.TicketID
+		}
+	}
+	return dl
+}
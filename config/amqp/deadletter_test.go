@@ -0,0 +1,49 @@
+package amqp
+
+import (
+	"testing"
+
+	streadway "github.com/streadway/amqp"
+)
+
+func TestOrigin(t *testing.T) {
+	death := func(exchange string, keys ...interface{}) streadway.Table {
+		return streadway.Table{"x-death": []interface{}{
+			streadway.Table{"exchange": exchange, "routing-keys": keys, "reason": "rejected"},
+			streadway.Table{"exchange": "older", "routing-keys": []interface{}{"OLD"}},
+		}}
+	}
+	tests := []struct {
+		name     string
+		headers  streadway.Table
+		exchange string
+		key      string
+		ok       bool
+	}{
+		{
+			name:     "quarantine headers",
+			headers:  streadway.Table{HeaderOriginalExchange: "EX", HeaderOriginalRoutingKey: "STORE.1.COMMAND"},
+			exchange: "EX", key: "STORE.1.COMMAND", ok: true,
+		},
+		{
+			name:     "broker dead-lettered: latest x-death entry",
+			headers:  death("EX", "STORE.1.COMMAND"),
+			exchange: "EX", key: "STORE.1.COMMAND", ok: true,
+		},
+		{
+			name:     "quarantine headers win over x-death",
+			headers:  streadway.Table{HeaderOriginalRoutingKey: "A", "x-death": death("EX", "B")["x-death"]},
+			exchange: "", key: "A", ok: true,
+		},
+		{name: "x-death without routing keys", headers: death("EX")},
+		{name: "no headers"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exchange, key, ok := origin(streadway.Delivery{Headers: tt.headers})
+			if exchange != tt.exchange || key != tt.key || ok != tt.ok {
+				t.Fatalf("origin = %q, %q, %v; want %q, %q, %v", exchange, key, ok, tt.exchange, tt.key, tt.ok)
+			}
+		})
+	}
+}
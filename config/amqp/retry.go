@@ -0,0 +1,72 @@
+package amqp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	streadway "github.com/streadway/amqp"
+)
+
+// Retry: pesan yang gagal karena error transient di-publish ke CLIENT_<store>.RETRY (ber-TTL).
+// Setelah TTL habis, RabbitMQ dead-letter balik ke exchange command dengan routing key store
+// → masuk lagi ke queue utama, header x-retry-count ikut terbawa.
+const HeaderRetryCount = "x-retry-count"
+
+const defaultRetryDelay = 10 * time.Second
+
+func retryQueue(queue string) string { return queue + ".RETRY" }
+
+func (c *Client) setupRetry(ctx context.Context, queue, exchange, routingKey string) error {
+	delay := c.RetryDelay
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+	args := c.Topology.queueTypeArgs()
+	args["x-message-ttl"] = int64(delay / time.Millisecond)
+	args["x-dead-letter-exchange"] = exchange
+	args["x-dead-letter-routing-key"] = routingKey
+	return c.DeclareQueueWithArgs(ctx, retryQueue(queue), args)
+}
+
+// RetryCount: berapa kali pesan ini sudah di-retry (0 untuk pengiriman pertama).
+func RetryCount(d streadway.Delivery) int {
+	switch v := d.Headers[HeaderRetryCount].(type) {
+	case int:
+		return v
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	}
+	return 0
+}
+
+// ScheduleRetry publish ulang pesan ke retry queue dengan x-retry-count = attempt, tunggu confirm broker,
+// baru ack pesan asli. Kalau publish gagal (error/nack/unroutable/timeout), pesan asli TIDAK disentuh:
+// caller yang memutuskan (consumer memindahnya ke DLQ), supaya tidak requeue-gagal-requeue tanpa jeda.
+func (c *Client) ScheduleRetry(queue string, d streadway.Delivery, attempt int) error {
+	headers := streadway.Table{}
+	for k, v := range d.Headers {
+		if k == "x-death" {
+			continue
+		}
+		headers[k] = v
+	}
+	headers[HeaderRetryCount] = int32(attempt)
+
+	if err := c.publishConfirmed("", retryQueue(queue), streadway.Publishing{
+		Headers:       headers,
+		ContentType:   d.ContentType,
+		MessageId:     d.MessageId,
+		CorrelationId: d.CorrelationId,
+		Timestamp:     d.Timestamp,
+		DeliveryMode:  streadway.Persistent,
+		Body:          d.Body,
+	}); err != nil {
+		return fmt.Errorf("publish to retry queue failed: %w", err)
+	}
+	return d.Ack(false)
+}
@@ -0,0 +1,162 @@
+package amqp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	streadway "github.com/streadway/amqp"
+)
+
+// StorePlaceholder di template Queue / RoutingKey diganti StoreID.
+const StorePlaceholder = "{store}"
+
+// Topology: nama exchange/queue/routing key + argumen queue. Dipakai SetupRepairQueue,
+// dead-letter/retry, dan publisher status, supaya staging & production (vhost berbeda)
+// bisa pakai prefix / nama sendiri.
+//
+// Prefix ditempel ke semua nama exchange & queue (bukan routing key).
+type Topology struct {
+	Prefix string `yaml:"prefix"`
+
+	Exchange     string `yaml:"exchange"`
+	ExchangeKind string `yaml:"exchangeKind"`
+	Queue        string `yaml:"queue"`      // template, mis. "CLIENT_{store}"
+	RoutingKey   string `yaml:"routingKey"` // template, mis. "STORE.{store}.COMMAND"
+
+	DeadLetterExchange string `yaml:"deadLetterExchange"`
+
+	StatusExchange     string `yaml:"statusExchange"`
+	StatusExchangeKind string `yaml:"statusExchangeKind"`
+	StatusRoutingKey   string `yaml:"statusRoutingKey"` // pastikan SAMA dgn binding di RabbitMQ
+
+	QueueArgs QueueArgs `yaml:"queueArgs"`
+}
+
+// QueueArgs: argumen queue command. Ubah argumen = queue lama harus dihapus dulu
+// (RabbitMQ menolak declare ulang dengan argumen berbeda).
+type QueueArgs struct {
+	Type         string `yaml:"type"`         // "classic" (default) / "quorum"; berlaku juga untuk DLQ & retry queue
+	MessageTTLMs int    `yaml:"messageTtlMs"` // x-message-ttl, 0 = tanpa TTL (pesan expired masuk DLQ)
+	MaxLength    int    `yaml:"maxLength"`    // x-max-length, 0 = tanpa batas
+	Overflow     string `yaml:"overflow"`     // x-overflow: drop-head / reject-publish / reject-publish-dlx
+
+	// DisableDeadLetter: queue tanpa x-dead-letter-exchange (Nack/expired dibuang, bukan ke DLQ).
+	// Quarantine consumer tetap publish langsung ke DLX.
+	DisableDeadLetter bool `yaml:"disableDeadLetter"`
+}
+
+// DefaultTopology: nama-nama lama (sebelum bisa dikonfigurasi).
+func DefaultTopology() Topology {
+	return Topology{
+		Exchange:           "REPAIR_TRANSACTION",
+		ExchangeKind:       "topic",
+		Queue:              "CLIENT_" + StorePlaceholder,
+		RoutingKey:         "STORE." + StorePlaceholder + ".COMMAND",
+		DeadLetterExchange: "REPAIR_TRANSACTION.DLX",
+		StatusExchange:     "REPAIR_STATUS_TRANSACTION",
+		StatusExchangeKind: "direct",
+		StatusRoutingKey:   "REPAIR.STATUS.UPDATED",
+		QueueArgs:          QueueArgs{Type: "classic"},
+	}
+}
+
+// Validate: semua kesalahan dilaporkan sekaligus.
+func (t Topology) Validate() error {
+	var errs []error
+	required := []struct{ name, val string }{
+		{"exchange", t.Exchange},
+		{"exchangeKind", t.ExchangeKind},
+		{"queue", t.Queue},
+		{"routingKey", t.RoutingKey},
+		{"deadLetterExchange", t.DeadLetterExchange},
+		{"statusExchange", t.StatusExchange},
+		{"statusExchangeKind", t.StatusExchangeKind},
+		{"statusRoutingKey", t.StatusRoutingKey},
+	}
+	for _, f := range required {
+		if strings.TrimSpace(f.val) == "" {
+			errs = append(errs, fmt.Errorf("topology.%s is required", f.name))
+		}
+	}
+	if !validKind(t.ExchangeKind) {
+		errs = append(errs, fmt.Errorf("topology.exchangeKind: unknown exchange kind %q", t.ExchangeKind))
+	}
+	if !validKind(t.StatusExchangeKind) {
+		errs = append(errs, fmt.Errorf("topology.statusExchangeKind: unknown exchange kind %q", t.StatusExchangeKind))
+	}
+	if !strings.Contains(t.Queue, StorePlaceholder) {
+		errs = append(errs, fmt.Errorf("topology.queue must contain %s", StorePlaceholder))
+	}
+	if !strings.Contains(t.RoutingKey, StorePlaceholder) {
+		errs = append(errs, fmt.Errorf("topology.routingKey must contain %s", StorePlaceholder))
+	}
+	switch t.QueueArgs.Type {
+	case "", "classic", "quorum":
+	default:
+		errs = append(errs, fmt.Errorf("topology.queueArgs.type: must be classic or quorum, got %q", t.QueueArgs.Type))
+	}
+	if t.QueueArgs.MessageTTLMs < 0 {
+		errs = append(errs, errors.New("topology.queueArgs.messageTtlMs must be >= 0"))
+	}
+	if t.QueueArgs.MaxLength < 0 {
+		errs = append(errs, errors.New("topology.queueArgs.maxLength must be >= 0"))
+	}
+	switch t.QueueArgs.Overflow {
+	case "", "drop-head", "reject-publish", "reject-publish-dlx":
+	default:
+		errs = append(errs, fmt.Errorf("topology.queueArgs.overflow: unknown value %q", t.QueueArgs.Overflow))
+	}
+	if t.QueueArgs.Overflow == "reject-publish-dlx" && t.QueueArgs.DisableDeadLetter {
+		errs = append(errs, errors.New("topology.queueArgs.overflow reject-publish-dlx needs dead-lettering enabled"))
+	}
+	return errors.Join(errs...)
+}
+
+func validKind(k string) bool {
+	switch k {
+	case "", "direct", "topic", "fanout", "headers":
+		return true
+	}
+	return false
+}
+
+func (t Topology) ExchangeName() string           { return t.Prefix + t.Exchange }
+func (t Topology) DeadLetterExchangeName() string { return t.Prefix + t.DeadLetterExchange }
+func (t Topology) StatusExchangeName() string     { return t.Prefix + t.StatusExchange }
+
+func (t Topology) QueueName(storeID string) string {
+	return t.Prefix + strings.ReplaceAll(t.Queue, StorePlaceholder, storeID)
+}
+
+func (t Topology) RoutingKeyFor(storeID string) string {
+	return strings.ReplaceAll(t.RoutingKey, StorePlaceholder, storeID)
+}
+
+// queueTypeArgs: x-queue-type untuk semua queue (utama, DLQ, retry).
+func (t Topology) queueTypeArgs() streadway.Table {
+	args := streadway.Table{}
+	if t.QueueArgs.Type == "quorum" {
+		args["x-queue-type"] = "quorum"
+	}
+	return args
+}
+
+// commandQueueArgs: argumen queue command utama.
+func (t Topology) commandQueueArgs(queue string) streadway.Table {
+	args := t.queueTypeArgs()
+	if !t.QueueArgs.DisableDeadLetter {
+		args["x-dead-letter-exchange"] = t.DeadLetterExchangeName()
+		args["x-dead-letter-routing-key"] = queue
+	}
+	if t.QueueArgs.MessageTTLMs > 0 {
+		args["x-message-ttl"] = int64(t.QueueArgs.MessageTTLMs)
+	}
+	if t.QueueArgs.MaxLength > 0 {
+		args["x-max-length"] = int64(t.QueueArgs.MaxLength)
+	}
+	if t.QueueArgs.Overflow != "" {
+		args["x-overflow"] = t.QueueArgs.Overflow
+	}
+	return args
+}
@@ -0,0 +1,91 @@
+package amqp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTopologyValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Topology)
+		want   []string // potongan pesan error; kosong = valid
+	}{
+		{name: "default", modify: func(*Topology) {}},
+		{name: "quorum with prefix", modify: func(t *Topology) { t.Prefix = "STG."; t.QueueArgs.Type = "quorum" }},
+		{
+			name:   "missing names reported together",
+			modify: func(t *Topology) { t.Exchange = " "; t.StatusRoutingKey = "" },
+			want:   []string{"topology.exchange is required", "topology.statusRoutingKey is required"},
+		},
+		{
+			name:   "store placeholder required",
+			modify: func(t *Topology) { t.Queue = "CLIENT"; t.RoutingKey = "STORE.COMMAND" },
+			want:   []string{"topology.queue must contain", "topology.routingKey must contain"},
+		},
+		{
+			name:   "unknown kinds",
+			modify: func(t *Topology) { t.ExchangeKind = "fan"; t.StatusExchangeKind = "x" },
+			want:   []string{"topology.exchangeKind", "topology.statusExchangeKind"},
+		},
+		{
+			name: "queue args",
+			modify: func(t *Topology) {
+				t.QueueArgs = QueueArgs{Type: "stream", MessageTTLMs: -1, MaxLength: -1, Overflow: "drop-tail"}
+			},
+			want: []string{"queueArgs.type", "messageTtlMs", "maxLength", "queueArgs.overflow"},
+		},
+		{
+			name: "reject-publish-dlx needs dead-lettering",
+			modify: func(t *Topology) {
+				t.QueueArgs.Overflow = "reject-publish-dlx"
+				t.QueueArgs.DisableDeadLetter = true
+			},
+			want: []string{"needs dead-lettering enabled"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			top := DefaultTopology()
+			tt.modify(&top)
+			err := top.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate = nil, want %v", tt.want)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("error does not mention %q:\n%v", w, err)
+				}
+			}
+		})
+	}
+}
+
+func TestTopologyNames(t *testing.T) {
+	top := DefaultTopology()
+	top.Prefix = "STG."
+	if got := top.QueueName("S01"); got != "STG.CLIENT_S01" {
+		t.Errorf("QueueName = %q", got)
+	}
+	if got := top.RoutingKeyFor("S01"); got != "STORE.S01.COMMAND" {
+		t.Errorf("RoutingKeyFor = %q (prefix must not apply to routing keys)", got)
+	}
+	if got := top.DeadLetterExchangeName(); got != "STG.REPAIR_TRANSACTION.DLX" {
+		t.Errorf("DeadLetterExchangeName = %q", got)
+	}
+
+	args := top.commandQueueArgs("STG.CLIENT_S01")
+	if args["x-dead-letter-exchange"] != "STG.REPAIR_TRANSACTION.DLX" || args["x-dead-letter-routing-key"] != "STG.CLIENT_S01" {
+		t.Errorf("commandQueueArgs = %v", args)
+	}
+	top.QueueArgs.DisableDeadLetter = true
+	if _, ok := top.commandQueueArgs("q")["x-dead-letter-exchange"]; ok {
+		t.Error("commandQueueArgs sets a dead-letter exchange while disabled")
+	}
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// isolate: kosongkan semua env yang dibaca Load supaya env mesin tidak ikut terbaca.
+func isolate(t *testing.T) {
+	t.Helper()
+	t.Setenv("CONFIG_FILE", "")
+	for _, st := range (&Config{}).settings() {
+		t.Setenv(st.env, "")
+	}
+}
+
+func writeFile(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	const file = "consumer:\n  workers: 5\nlog:\n  level: warn\n"
+	tests := []struct {
+		name        string
+		file        string
+		env         map[string]string
+		args        []string
+		wantWorkers int
+		wantLevel   string
+	}{
+		{name: "default", wantWorkers: 4, wantLevel: "info"},
+		{name: "file over default", file: file, wantWorkers: 5, wantLevel: "warn"},
+		{
+			name:        "env over file",
+			file:        file,
+			env:         map[string]string{"CONSUMER_WORKERS": "6"},
+			wantWorkers: 6, wantLevel: "warn",
+		},
+		{
+			name:        "flag over env",
+			file:        file,
+			env:         map[string]string{"CONSUMER_WORKERS": "6", "LOG_LEVEL": "debug"},
+			args:        []string{"-workers", "7"},
+			wantWorkers: 7, wantLevel: "debug",
+		},
+		{
+			name:        "empty env does not override file",
+			file:        file,
+			env:         map[string]string{"CONSUMER_WORKERS": "  "},
+			wantWorkers: 5, wantLevel: "warn",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolate(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, tt.file)}, args...)
+			}
+			cfg, err := Load(args)
+			if err != nil {
+				t.Fatalf("Load = %v", err)
+			}
+			if cfg.Consumer.Workers != tt.wantWorkers || cfg.Log.Level != tt.wantLevel {
+				t.Fatalf("workers=%d level=%q, want %d %q", cfg.Consumer.Workers, cfg.Log.Level, tt.wantWorkers, tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestLoadReportsEveryError(t *testing.T) {
+	isolate(t)
+	t.Setenv("CONSUMER_WORKERS", "many")
+	t.Setenv("RETRY_DELAY_MS", "0")
+	path := writeFile(t, "log:\n  level: loud\ndb:\n  name: \"\"\n")
+
+	_, err := Load([]string{"-config", path, "-db-port", "70000", "-amqp-queue-dead-letter", "maybe"})
+	if err == nil {
+		t.Fatal("Load = nil, want errors")
+	}
+	for _, want := range []string{
+		"CONSUMER_WORKERS",
+		"-amqp-queue-dead-letter",
+		"db.port",
+		"db.name",
+		"log.level",
+		"retry.delayMs",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadKeepsPasswordsUntrimmed(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		args    []string
+		wantNew string
+		wantOld string
+		wantUsr string
+	}{
+		{
+			name:    "env",
+			env:     map[string]string{"PASSWORD": " s3cret ", "PASSWORD_OLD": "old\t", "DB_USER": " sa "},
+			wantNew: " s3cret ", wantOld: "old\t", wantUsr: "sa",
+		},
+		{
+			name:    "flag",
+			args:    []string{"-db-password", "  p ", "-db-user", " app "},
+			wantNew: "  p ", wantUsr: "app",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolate(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := Load(tt.args)
+			if err != nil {
+				t.Fatalf("Load = %v", err)
+			}
+			if cfg.DB.PwdNew != tt.wantNew || cfg.DB.PwdOld != tt.wantOld {
+				t.Fatalf("passwords = %q / %q, want %q / %q", cfg.DB.PwdNew, cfg.DB.PwdOld, tt.wantNew, tt.wantOld)
+			}
+			if cfg.DB.DBUser != tt.wantUsr {
+				t.Fatalf("user = %q, want %q (non-secret values are trimmed)", cfg.DB.DBUser, tt.wantUsr)
+			}
+		})
+	}
+}
+
+func TestLoadExample(t *testing.T) {
+	isolate(t)
+	if _, err := Load([]string{"-config", "../config.example.yaml"}); err != nil {
+		t.Fatalf("Load example: %v", err)
+	}
+}
@@ -5,31 +5,27 @@ import (
 	"database/sql"
 	"fmt"
 	"net/url"
-	"os"
-	"strconv"
-	"strings"
 	"time"
 
 	_ "github.com/denisenkom/go-mssqldb"
 )
 
 type Config struct {
-	DBServer string
-	DBPort   int
-	DBName   string
-	DBUser   string
-	PwdOld   string
-	PwdNew   string
+	DBServer string `yaml:"server"`
+	DBPort   int    `yaml:"port"`
+	DBName   string `yaml:"name"`
+	DBUser   string `yaml:"user"`
+	PwdOld   string `yaml:"passwordOld"`
+	PwdNew   string `yaml:"password"`
 }
 
-func Load() *Config {
-	return &Config{
-		DBServer: get("DB_SERVER", "127.0.0.1"),
-		DBPort:   getInt("DB_PORT", 1433),
-		DBName:   get("DB_NAME", "NEW_POS"),
-		DBUser:   get("DB_USER", "sa"),
-		PwdOld:   os.Getenv("PASSWORD_OLD"),
-		PwdNew:   os.Getenv("PASSWORD"),
+// Default: nilai default sebelum file / env (lihat package config).
+func Default() Config {
+	return Config{
+		DBServer: "127.0.0.1",
+		DBPort:   1433,
+		DBName:   "NEW_POS",
+		DBUser:   "sa",
 	}
 }
 
@@ -90,18 +86,3 @@ func ping(ctx context.Context, db *sql.DB) error {
 	defer cancel()
 	return db.PingContext(c)
 }
-
-func get(k, def string) string {
-	if v := strings.TrimSpace(os.Getenv(k)); v != "" {
-		return v
-	}
-	return def
-}
-func getInt(k string, def int) int {
-	if v := strings.TrimSpace(os.Getenv(k)); v != "" {
-		if i, err := strconv.Atoi(v); err == nil {
-			return i
-		}
-	}
-	return def
-}
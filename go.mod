@@ -8,6 +8,7 @@ require (
 	github.com/lmittmann/tint v1.1.2
 	github.com/mattn/go-isatty v0.0.20
 	github.com/streadway/amqp v1.1.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"CommandHandler/types"
+)
+
+// auditTable: tabel lokal, dibuat otomatis oleh EnsureSchema saat startup.
+const auditTable = "CMD_AUDIT_LOG"
+
+const createAuditTable = `
+IF OBJECT_ID(N'dbo.` + auditTable + `', N'U') IS NULL
+CREATE TABLE dbo.` + auditTable + ` (
+  ID           BIGINT IDENTITY(1,1) PRIMARY KEY,
+  TicketID     NVARCHAR(100) NOT NULL,
+  SenderNIK    NVARCHAR(50)  NOT NULL,
+  CommandType  NVARCHAR(50)  NOT NULL,
+  TableName    NVARCHAR(100) NOT NULL,
+  RowKey       NVARCHAR(MAX) NOT NULL,
+  BeforeValues NVARCHAR(MAX) NULL,
+  AfterValues  NVARCHAR(MAX) NULL,
+  CreatedAt    DATETIME2     NOT NULL
+)
+`
+
+// EnsureSchema membuat tabel-tabel lokal milik service (kalau belum ada).
+func (s *Service) EnsureSchema(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	for table, ddl := range map[string]string{
+		auditTable:     createAuditTable,
+		processedTable: createProcessedTable,
+		outboxTable:    createOutboxTable,
+	} {
+		if _, err := s.DB.ExecContext(ctx, ddl); err != nil {
+			return fmt.Errorf("create %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// writeAudit menulis before/after tiap baris ke tabel audit, di transaksi yang sama dengan perubahan.
+func writeAudit(ctx context.Context, tx *sql.Tx, m Meta, changes []types.RowChange) error {
+	const q = `
+INSERT INTO dbo.` + auditTable + `
+  (TicketID, SenderNIK, CommandType, TableName, RowKey, BeforeValues, AfterValues, CreatedAt)
+VALUES
+  (@ticketId, @senderNik, @commandType, @tableName, @rowKey, @before, @after, SYSDATETIME())
+`
+	for _, c := range changes {
+		key, _ := json.Marshal(c.Key)
+		if _, err := tx.ExecContext(
+			ctx, q,
+			sql.Named("ticketId", m.TicketID),
+			sql.Named("senderNik", m.SenderNIK),
+			sql.Named("commandType", string(m.CommandType)),
+			sql.Named("tableName", c.Table),
+			sql.Named("rowKey", string(key)),
+			sql.Named("before", jsonOrNull(c.Before)),
+			sql.Named("after", jsonOrNull(c.After)),
+		); err != nil {
+			return fmt.Errorf("write audit %s: %w", c.Table, err)
+		}
+	}
+	return nil
+}
+
+func jsonOrNull(v map[string]any) sql.NullString {
+	if v == nil {
+		return sql.NullString{}
+	}
+	b, _ := json.Marshal(v)
+	return sql.NullString{String: string(b), Valid: true}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"CommandHandler/types"
+	"CommandHandler/utils"
+)
+
+// parseBillRef memvalidasi ID_TR_SALES_HEADER + grandTotal dari payload
+// dan mengembalikan id (trim) serta grandTotal dalam bentuk int.
+func parseBillRef(rawID, rawGrandTotal string) (string, int, error) {
+	id := strings.TrimSpace(rawID)
+	gt := strings.TrimSpace(rawGrandTotal)
+	if id == "" || gt == "" {
+		return "", 0, fmt.Errorf("missing ID_TR_SALES_HEADER or grandTotal")
+	}
+	if len(id) < 12 {
+		return "", 0, fmt.Errorf("ID_TR_SALES_HEADER must be >= 12 chars")
+	}
+	grandInt, err := strconv.Atoi(gt)
+	if err != nil {
+		return "", 0, fmt.Errorf("grandTotal must be an integer string: %v", err)
+	}
+	return id, grandInt, nil
+}
+
+// bill: baris TR_SALES_HEADER hasil lookup (kolom yang mungkin diubah ikut diambil sebagai "before").
+type bill struct {
+	ID          string
+	OrderOnline sql.NullString
+	StatusKirim sql.NullString
+}
+
+// findBill mencari billcode berdasarkan 6 karakter kiri/kanan ID + Grand_Total.
+func findBill(ctx context.Context, tx *sql.Tx, id string, grandInt int) (bill, error) {
+	left6 := id[:6]
+	right6 := id[len(id)-6:]
+
+	var b bill
+	const q = `
+SELECT TOP 1 ID_TR_SALES_HEADER, order_online, status_kirim
+FROM TR_SALES_HEADER
+WHERE LEFT(LTRIM(RTRIM(ID_TR_SALES_HEADER)), 6) = @left
+  AND RIGHT(LTRIM(RTRIM(ID_TR_SALES_HEADER)), 6) = @right
+  AND CAST(Grand_Total AS INT) = @grandTotal
+`
+	if err := tx.QueryRowContext(
+		ctx, q,
+		sql.Named("left", left6),
+		sql.Named("right", right6),
+		sql.Named("grandTotal", grandInt),
+	).Scan(&b.ID, &b.OrderOnline, &b.StatusKirim); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return bill{}, fmt.Errorf("billcode not found: left=%s right=%s grandTotal=%d", left6, right6, grandInt)
+		}
+		return bill{}, fmt.Errorf("query header failed: %w", err)
+	}
+	return b, nil
+}
+
+// availablePaymentTypes: diagnostik, list tipe bayar yang ada pada billcode (format "TIPE(count)").
+func availablePaymentTypes(ctx context.Context, tx *sql.Tx, billcode string) []string {
+	rows, _ := tx.QueryContext(ctx, `
+		SELECT DISTINCT LTRIM(RTRIM(TIPE_BAYAR)) AS tipe, COUNT(*) cnt
+		FROM TR_SALES_PAYMENT_DETAIL
+		WHERE ID_TR_SALES_HEADER = @billcode
+		GROUP BY LTRIM(RTRIM(TIPE_BAYAR))
+	`, sql.Named("billcode", billcode))
+	var got []string
+	for rows != nil && rows.Next() {
+		var tipe string
+		var cnt int
+		_ = rows.Scan(&tipe, &cnt)
+		got = append(got, fmt.Sprintf("%s(%d)", strings.ToUpper(strings.TrimSpace(tipe)), cnt))
+	}
+	if rows != nil {
+		rows.Close()
+	}
+	return got
+}
+
+// normalizePaymentType: key → value (DBCA → D.BCA); kalau sudah value biarkan.
+func normalizePaymentType(in string) string {
+	out := in
+	if v, err := utils.GetPaymentValue(in); err == nil && v != "" {
+		out = v
+	}
+	return strings.TrimSpace(out)
+}
+
+func isOrderOnline(v sql.NullString) bool {
+	return v.Valid && strings.TrimSpace(v.String) == "1"
+}
+
+// cashDrawerKeterangan: order online selalu dicatat "Online" di LOG_CASHDRAWER,
+// selain itu pakai deskripsi dari tipe bayar.
+func cashDrawerKeterangan(online bool, paymentType string) string {
+	if online {
+		return "Online"
+	}
+	return utils.CashDrawerLogDescription(paymentType)
+}
+
+// sameTime: predikat "col sama dengan @param" untuk waktu yang dibaca driver lalu dikirim balik.
+// time.Time dikirim sebagai datetimeoffset(7); kolom datetime (presisi 1/300 detik) bisa selisih
+// < 1 ms setelah konversi (tergantung compat level), jadi "=" bisa tidak ketemu. Toleransi 1 ms.
+func sameTime(col, param string) string {
+	return "ABS(DATEDIFF(millisecond, " + col + ", @" + param + ")) <= 1"
+}
+
+// nullStr: NullString → any (nil kalau NULL), untuk snapshot before/after.
+func nullStr(v sql.NullString) any {
+	if !v.Valid {
+		return nil
+	}
+	return v.String
+}
+
+// paymentDetail: baris TR_SALES_PAYMENT_DETAIL (kolom yang dipakai saja).
+type paymentDetail struct {
+	WaktuUrut time.Time
+	Bayar     int
+	TipeBayar string
+}
+
+func (d paymentDetail) key(billcode string) map[string]any {
+	return map[string]any{"ID_TR_SALES_HEADER": billcode, "WAKTU_URUT": d.WaktuUrut}
+}
+
+// queryPaymentDetails: query harus SELECT WAKTU_URUT, CAST(BAYAR AS INT), TIPE_BAYAR.
+func queryPaymentDetails(ctx context.Context, tx *sql.Tx, q string, args ...any) ([]paymentDetail, error) {
+	rows, err := tx.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []paymentDetail
+	for rows.Next() {
+		var d paymentDetail
+		if err := rows.Scan(&d.WaktuUrut, &d.Bayar, &d.TipeBayar); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// headerChange: snapshot TR_SALES_HEADER; after = kolom yang di-set command.
+func headerChange(b bill, after map[string]any) types.RowChange {
+	before := map[string]any{}
+	for col := range after {
+		switch col {
+		case "order_online":
+			before[col] = nullStr(b.OrderOnline)
+		case "status_kirim":
+			before[col] = nullStr(b.StatusKirim)
+		}
+	}
+	return types.RowChange{
+		Table:  "TR_SALES_HEADER",
+		Key:    map[string]any{"ID_TR_SALES_HEADER": b.ID},
+		Before: before,
+		After:  after,
+	}
+}
@@ -0,0 +1,352 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"CommandHandler/types"
+)
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// dayPayment: baris payment 1 hari + Keterangan LOG_CASHDRAWER yang seharusnya.
+type dayPayment struct {
+	Billcode string
+	paymentDetail
+	Online     bool
+	Keterangan string
+}
+
+// drawerRow: baris LOG_CASHDRAWER (kolom yang dipakai saja).
+type drawerRow struct {
+	Tanggal    time.Time
+	CashIn     int
+	Keterangan string
+}
+
+// parseDay: "YYYY-MM-DD" → awal hari (UTC, sama seperti nilai datetime hasil scan driver).
+func parseDay(s string) (time.Time, error) {
+	d, err := time.Parse("2006-01-02", strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("date must be YYYY-MM-DD")
+	}
+	return d, nil
+}
+
+// loadDayPayments: semua payment detail tanggal day, urut WAKTU_URUT.
+func loadDayPayments(ctx context.Context, db queryer, day time.Time) ([]dayPayment, error) {
+	const q = `
+SELECT
+  d.ID_TR_SALES_HEADER,
+  d.WAKTU_URUT,
+  CAST(d.BAYAR AS INT) AS BAYAR,
+  d.TIPE_BAYAR,
+  h.order_online
+FROM TR_SALES_PAYMENT_DETAIL d
+JOIN TR_SALES_HEADER h ON h.ID_TR_SALES_HEADER = d.ID_TR_SALES_HEADER
+WHERE d.WAKTU_URUT >= @day AND d.WAKTU_URUT < @next
+ORDER BY d.WAKTU_URUT
+`
+	rows, err := db.QueryContext(ctx, q, sql.Named("day", day), sql.Named("next", day.AddDate(0, 0, 1)))
+	if err != nil {
+		return nil, fmt.Errorf("query payment detail failed: %w", err)
+	}
+	defer rows.Close()
+
+	var out []dayPayment
+	for rows.Next() {
+		var p dayPayment
+		var online sql.NullString
+		if err := rows.Scan(&p.Billcode, &p.WaktuUrut, &p.Bayar, &p.TipeBayar, &online); err != nil {
+			return nil, fmt.Errorf("scan payment detail failed: %w", err)
+		}
+		p.Online = isOrderOnline(online)
+		p.Keterangan = strings.TrimSpace(cashDrawerKeterangan(p.Online, strings.TrimSpace(p.TipeBayar)))
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// loadDayDrawer: semua baris LOG_CASHDRAWER tanggal day dengan CashIn > 0, urut Tanggal.
+func loadDayDrawer(ctx context.Context, db queryer, day time.Time) ([]drawerRow, error) {
+	const q = `
+SELECT Tanggal, CAST(CashIn AS INT) AS CashIn, LTRIM(RTRIM(Keterangan)) AS Keterangan
+FROM LOG_CASHDRAWER
+WHERE Tanggal >= @day AND Tanggal < @next
+  AND CashIn > 0
+ORDER BY Tanggal
+`
+	rows, err := db.QueryContext(ctx, q, sql.Named("day", day), sql.Named("next", day.AddDate(0, 0, 1)))
+	if err != nil {
+		return nil, fmt.Errorf("query log cashdrawer failed: %w", err)
+	}
+	defer rows.Close()
+
+	var out []drawerRow
+	for rows.Next() {
+		var r drawerRow
+		if err := rows.Scan(&r.Tanggal, &r.CashIn, &r.Keterangan); err != nil {
+			return nil, fmt.Errorf("scan log cashdrawer failed: %w", err)
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// ReconcileCashdrawer: laporan selisih payment detail vs LOG_CASHDRAWER per Keterangan untuk 1 tanggal.
+// Read-only, tidak pernah mengubah data.
+func (s *Service) ReconcileCashdrawer(ctx context.Context, p types.PayloadReconcileCashdrawer) (types.ResponseReconcileCashdrawer, error) {
+	day, err := parseDay(p.Date)
+	if err != nil {
+		return types.ResponseReconcileCashdrawer{}, err
+	}
+	payments, err := loadDayPayments(ctx, s.DB, day)
+	if err != nil {
+		return types.ResponseReconcileCashdrawer{}, err
+	}
+	drawer, err := loadDayDrawer(ctx, s.DB, day)
+	if err != nil {
+		return types.ResponseReconcileCashdrawer{}, err
+	}
+	return reconcile(day, payments, drawer), nil
+}
+
+// reconcile: kelompokkan payment dan baris drawer per Keterangan (urut nama), hitung selisihnya.
+func reconcile(day time.Time, payments []dayPayment, drawer []drawerRow) types.ResponseReconcileCashdrawer {
+	groups := map[string]*types.CashdrawerGroup{}
+	group := func(k string) *types.CashdrawerGroup {
+		g := groups[k]
+		if g == nil {
+			g = &types.CashdrawerGroup{Keterangan: k}
+			groups[k] = g
+		}
+		return g
+	}
+	out := types.ResponseReconcileCashdrawer{Date: day.Format("2006-01-02"), Groups: []types.CashdrawerGroup{}}
+	for _, pay := range payments {
+		g := group(pay.Keterangan)
+		g.PaymentTotal += pay.Bayar
+		g.PaymentCount++
+		out.PaymentTotal += pay.Bayar
+	}
+	for _, r := range drawer {
+		g := group(r.Keterangan)
+		g.DrawerTotal += r.CashIn
+		g.DrawerCount++
+		out.DrawerTotal += r.CashIn
+	}
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		g := groups[k]
+		g.Difference = g.DrawerTotal - g.PaymentTotal
+		if g.Difference != 0 || g.DrawerCount != g.PaymentCount {
+			out.Discrepancies++
+		}
+		out.Groups = append(out.Groups, *g)
+	}
+	out.Balanced = out.Discrepancies == 0
+	return out
+}
+
+const (
+	defaultFixRows = 50
+	maxFixRows     = 500
+)
+
+// FixCashdrawer: betulkan Keterangan LOG_CASHDRAWER yang salah label untuk 1 tanggal.
+// Payment detail = sumber kebenaran (order online → "Online"). Pencocokan seperti REPAIR_PAYMENT (5):
+// tanggal + CashIn = BAYAR. Baris yang sudah benar dipasangkan dulu; sisanya dipasangkan dengan baris
+// drawer bernominal sama (waktu terdekat) lalu Keterangan-nya diganti. Baris drawer yang labelnya bukan
+// label payment tidak pernah diganti. Lebih dari maxRows → ditolak.
+func (s *Service) FixCashdrawer(ctx context.Context, m Meta, p types.PayloadFixCashdrawer) (types.ResponseFixCashdrawer, error) {
+	day, err := parseDay(p.Date)
+	if err != nil {
+		return types.ResponseFixCashdrawer{}, err
+	}
+	limit := p.MaxRows
+	if limit <= 0 {
+		limit = defaultFixRows
+	}
+	if limit > maxFixRows {
+		return types.ResponseFixCashdrawer{}, fmt.Errorf("maxRows must be <= %d", maxFixRows)
+	}
+
+	// policy: batas umur transaksi yang boleh diubah
+	if err := m.Policy.CheckDaysBack(day, time.Now()); err != nil {
+		return types.ResponseFixCashdrawer{}, err
+	}
+
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return types.ResponseFixCashdrawer{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }() // aman walau sudah commit
+
+	payments, err := loadDayPayments(ctx, tx, day)
+	if err != nil {
+		return types.ResponseFixCashdrawer{}, err
+	}
+	all, err := loadDayDrawer(ctx, tx, day)
+	if err != nil {
+		return types.ResponseFixCashdrawer{}, err
+	}
+	// Hanya baris berlabel payment yang boleh dipasangkan/diganti; sisanya (modal awal, setoran
+	// manual, ...) langsung dilaporkan sebagai unmatched.
+	drawer, other := splitDrawer(all, paymentLabels(payments))
+
+	// (1) Pasangkan yang sudah benar (nominal + Keterangan sama)
+	used := make([]bool, len(drawer))
+	var pending []dayPayment
+	for _, pay := range payments {
+		if i := pickDrawer(drawer, used, pay, true); i >= 0 {
+			used[i] = true
+			continue
+		}
+		pending = append(pending, pay)
+	}
+
+	// (2) Sisanya: baris drawer bernominal sama tapi Keterangan salah → kandidat perbaikan
+	out := types.ResponseFixCashdrawer{Date: day.Format("2006-01-02"), Rows: []types.CashdrawerFix{}, DryRun: m.DryRun}
+	for _, pay := range pending {
+		i := pickDrawer(drawer, used, pay, false)
+		if i < 0 {
+			out.UnmatchedPayments = append(out.UnmatchedPayments, types.CashdrawerEntry{
+				Billcode:   pay.Billcode,
+				Tanggal:    pay.WaktuUrut,
+				Amount:     pay.Bayar,
+				Keterangan: pay.Keterangan,
+			})
+			continue
+		}
+		used[i] = true
+		out.Rows = append(out.Rows, types.CashdrawerFix{
+			Billcode: pay.Billcode,
+			Tanggal:  drawer[i].Tanggal,
+			CashIn:   drawer[i].CashIn,
+			Before:   drawer[i].Keterangan,
+			After:    pay.Keterangan,
+		})
+	}
+	for i, r := range drawer {
+		if !used[i] {
+			other = append(other, r)
+		}
+	}
+	sort.SliceStable(other, func(i, j int) bool { return other[i].Tanggal.Before(other[j].Tanggal) })
+	for _, r := range other {
+		out.UnmatchedDrawer = append(out.UnmatchedDrawer, types.CashdrawerEntry{
+			Tanggal:    r.Tanggal,
+			Amount:     r.CashIn,
+			Keterangan: r.Keterangan,
+		})
+	}
+	out.Fixed = len(out.Rows)
+	if out.Fixed > limit {
+		return types.ResponseFixCashdrawer{}, fmt.Errorf("%d rows need fixing, more than maxRows %d", out.Fixed, limit)
+	}
+
+	// (3) Update Keterangan
+	q := `
+WITH TargetRow AS (
+  SELECT TOP 1 *
+  FROM LOG_CASHDRAWER
+  WHERE ` + sameTime("Tanggal", "tanggal") + `
+    AND CashIn = @cashIn
+    AND LTRIM(RTRIM(Keterangan)) = @keteranganLama
+)
+UPDATE TargetRow
+SET Keterangan = @keteranganBaru;
+`
+	var changes []types.RowChange
+	for _, f := range out.Rows {
+		res, err := tx.ExecContext(
+			ctx, q,
+			sql.Named("tanggal", f.Tanggal),
+			sql.Named("cashIn", f.CashIn),
+			sql.Named("keteranganLama", f.Before),
+			sql.Named("keteranganBaru", f.After),
+		)
+		if err != nil {
+			return types.ResponseFixCashdrawer{}, fmt.Errorf("update LOG_CASHDRAWER failed: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n != 1 {
+			return types.ResponseFixCashdrawer{}, fmt.Errorf("update LOG_CASHDRAWER %s affected %d rows, expected 1", f.Tanggal.Format(time.RFC3339), n)
+		}
+		changes = append(changes, types.RowChange{
+			Table:  "LOG_CASHDRAWER",
+			Key:    map[string]any{"Tanggal": f.Tanggal, "CashIn": f.CashIn},
+			Before: map[string]any{"Keterangan": f.Before},
+			After:  map[string]any{"Keterangan": f.After},
+		})
+	}
+
+	// Audit trail (ikut transaksi; dry-run ikut ke-rollback)
+	if err = writeAudit(ctx, tx, m, changes); err != nil {
+		return types.ResponseFixCashdrawer{}, err
+	}
+
+	// Commit (atau rollback kalau dry-run)
+	if err = finish(ctx, tx, m, out); err != nil {
+		return types.ResponseFixCashdrawer{}, fmt.Errorf("commit failed: %w", err)
+	}
+	return out, nil
+}
+
+// paymentLabels: semua Keterangan yang bisa dihasilkan cashDrawerKeterangan — "Online", deskripsi tiap
+// tipe bayar yang dikenal, dan label payment hari itu (mis. QRIS bank yang tidak ada di daftar).
+func paymentLabels(payments []dayPayment) map[string]bool {
+	labels := map[string]bool{cashDrawerKeterangan(true, ""): true}
+	for _, v := range types.PaymentKeyToValue {
+		labels[cashDrawerKeterangan(false, v)] = true
+	}
+	for _, pay := range payments {
+		labels[pay.Keterangan] = true
+	}
+	return labels
+}
+
+// splitDrawer: pisahkan baris drawer berlabel payment dari yang bukan (urutan tetap).
+func splitDrawer(drawer []drawerRow, labels map[string]bool) (payment, other []drawerRow) {
+	for _, r := range drawer {
+		if labels[r.Keterangan] {
+			payment = append(payment, r)
+		} else {
+			other = append(other, r)
+		}
+	}
+	return payment, other
+}
+
+// pickDrawer: index baris drawer yang belum dipakai dengan CashIn = BAYAR (dan Keterangan sama kalau
+// sameLabel), waktu paling dekat dengan WAKTU_URUT. -1 kalau tidak ada.
+func pickDrawer(drawer []drawerRow, used []bool, pay dayPayment, sameLabel bool) int {
+	best := -1
+	var bestGap time.Duration
+	for i, r := range drawer {
+		if used[i] || r.CashIn != pay.Bayar {
+			continue
+		}
+		if sameLabel != (r.Keterangan == pay.Keterangan) {
+			continue
+		}
+		gap := r.Tanggal.Sub(pay.WaktuUrut)
+		if gap < 0 {
+			gap = -gap
+		}
+		if best < 0 || gap < bestGap {
+			best, bestGap = i, gap
+		}
+	}
+	return best
+}
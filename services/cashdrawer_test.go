@@ -0,0 +1,106 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"CommandHandler/types"
+)
+
+func TestSplitDrawerKeepsNonPaymentRows(t *testing.T) {
+	at := func(h int) time.Time { return time.Date(2026, 10, 18, h, 0, 0, 0, time.UTC) }
+	payments := []dayPayment{{Keterangan: "QRIS BSI"}} // bank di luar daftar tetap label payment
+	drawer := []drawerRow{
+		{Tanggal: at(7), CashIn: 500000, Keterangan: "Modal Awal"},
+		{Tanggal: at(8), CashIn: 10000, Keterangan: "Cash"},
+		{Tanggal: at(9), CashIn: 20000, Keterangan: "Online"},
+		{Tanggal: at(10), CashIn: 30000, Keterangan: "Debet Card"},
+		{Tanggal: at(11), CashIn: 40000, Keterangan: "QRIS BSI"},
+		{Tanggal: at(12), CashIn: 50000, Keterangan: "Setoran"},
+	}
+
+	payment, other := splitDrawer(drawer, paymentLabels(payments))
+	if len(payment) != 4 {
+		t.Fatalf("payment rows = %+v, want Cash, Online, Debet Card, QRIS BSI", payment)
+	}
+	if len(other) != 2 || other[0].Keterangan != "Modal Awal" || other[1].Keterangan != "Setoran" {
+		t.Fatalf("other rows = %+v, want Modal Awal, Setoran", other)
+	}
+}
+
+func TestPickDrawer(t *testing.T) {
+	at := func(m int) time.Time { return time.Date(2026, 10, 18, 10, m, 0, 0, time.UTC) }
+	drawer := []drawerRow{
+		{Tanggal: at(0), CashIn: 10000, Keterangan: "Cash"},
+		{Tanggal: at(4), CashIn: 10000, Keterangan: "Debet Card"},
+		{Tanggal: at(6), CashIn: 10000, Keterangan: "Cash"},
+		{Tanggal: at(5), CashIn: 20000, Keterangan: "Cash"},
+	}
+	pay := func(m, bayar int, label string) dayPayment {
+		return dayPayment{paymentDetail: paymentDetail{WaktuUrut: at(m), Bayar: bayar}, Keterangan: label}
+	}
+	tests := []struct {
+		name      string
+		pay       dayPayment
+		used      []int
+		sameLabel bool
+		want      int
+	}{
+		{name: "same label, nearest in time", pay: pay(5, 10000, "Cash"), sameLabel: true, want: 2},
+		{name: "nearest already used", pay: pay(5, 10000, "Cash"), used: []int{2}, sameLabel: true, want: 0},
+		{name: "other label for relabel", pay: pay(5, 10000, "Cash"), sameLabel: false, want: 1},
+		{name: "relabel candidate must differ in label", pay: pay(5, 10000, "Debet Card"), sameLabel: false, want: 2},
+		{name: "amount must match", pay: pay(5, 30000, "Cash"), sameLabel: true, want: -1},
+		{name: "all used", pay: pay(5, 20000, "Cash"), used: []int{3}, sameLabel: true, want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			used := make([]bool, len(drawer))
+			for _, i := range tt.used {
+				used[i] = true
+			}
+			if got := pickDrawer(drawer, used, tt.pay, tt.sameLabel); got != tt.want {
+				t.Fatalf("pickDrawer = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileGroups(t *testing.T) {
+	day := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	payments := []dayPayment{
+		{paymentDetail: paymentDetail{Bayar: 10000}, Keterangan: "Cash"},
+		{paymentDetail: paymentDetail{Bayar: 5000}, Keterangan: "Cash"},
+		{paymentDetail: paymentDetail{Bayar: 20000}, Keterangan: "Online"},
+		{paymentDetail: paymentDetail{Bayar: 7000}, Keterangan: "Debet Card"},
+	}
+	drawer := []drawerRow{
+		{CashIn: 15000, Keterangan: "Cash"},        // total sama, jumlah baris beda
+		{CashIn: 20000, Keterangan: "Online"},      // cocok
+		{CashIn: 7000, Keterangan: "Credit Card"},  // salah label
+		{CashIn: 500000, Keterangan: "Modal Awal"}, // tanpa payment
+	}
+
+	got := reconcile(day, payments, drawer)
+	want := []types.CashdrawerGroup{
+		{Keterangan: "Cash", PaymentTotal: 15000, PaymentCount: 2, DrawerTotal: 15000, DrawerCount: 1},
+		{Keterangan: "Credit Card", DrawerTotal: 7000, DrawerCount: 1, Difference: 7000},
+		{Keterangan: "Debet Card", PaymentTotal: 7000, PaymentCount: 1, Difference: -7000},
+		{Keterangan: "Modal Awal", DrawerTotal: 500000, DrawerCount: 1, Difference: 500000},
+		{Keterangan: "Online", PaymentTotal: 20000, PaymentCount: 1, DrawerTotal: 20000, DrawerCount: 1},
+	}
+	if !reflect.DeepEqual(got.Groups, want) {
+		t.Fatalf("groups =\n%+v\nwant\n%+v", got.Groups, want)
+	}
+	if got.Date != "2026-10-18" || got.PaymentTotal != 42000 || got.DrawerTotal != 542000 {
+		t.Fatalf("totals = %s %d %d", got.Date, got.PaymentTotal, got.DrawerTotal)
+	}
+	if got.Discrepancies != 4 || got.Balanced {
+		t.Fatalf("discrepancies = %d balanced = %v, want 4 false", got.Discrepancies, got.Balanced)
+	}
+
+	if empty := reconcile(day, nil, nil); !empty.Balanced || empty.Groups == nil {
+		t.Fatalf("empty day = %+v, want balanced with empty (non-nil) groups", empty)
+	}
+}
@@ -4,8 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt" // <-- tambah
+	"hash/fnv"
+	"runtime/debug"
+	"sync"
 
+	amqpc "CommandHandler/config/amqp"
 	"CommandHandler/services/dispatcher"
+	"CommandHandler/services/signing"
 	"CommandHandler/types"
 	"CommandHandler/utils"
 
@@ -25,9 +30,47 @@ func unwrapToCommand(body []byte, out *types.Command) error {
 	return json.Unmarshal(body, out)
 }
 
-func Start(ctx context.Context, log *utils.Logger, ch *amqp.Channel, queue string, h *dispatcher.Handler) error {
-	// Batasi in-flight messages agar stabil
-	if err := ch.Qos(10, 0, false); err != nil {
+// quarantine: pindahkan pesan ke DLQ (bukan di-drop) supaya bisa dicek dan di-requeue.
+func quarantine(log *utils.Logger, c *amqpc.Client, queue string, d amqp.Delivery, reason, stack string) {
+	if err := c.Quarantine(queue, d, reason, stack); err != nil {
+		log.Fail("quarantine failed", "err", err)
+		return
+	}
+	log.Warn("☠️ message dead-lettered", "queue", queue, "reason", reason)
+}
+
+// job: 1 delivery yang sudah di-parse, siap diproses worker.
+type job struct {
+	d   amqp.Delivery
+	cmd types.Command
+}
+
+// Options: pengaturan consumer.
+type Options struct {
+	Workers int              // jumlah worker paralel (min 1)
+	Keys    *signing.Keyring // nil → verifikasi signature tidak aktif
+
+	Broker *amqpc.Client // publish ke retry queue / DLQ dengan confirm
+}
+
+// Start consume queue dengan opt.Workers goroutine paralel. Command untuk bill yang sama
+// (BillKey: kiri/kanan ID + grandTotal) selalu masuk lane yang sama → urutannya tetap terjaga. Command Exclusive
+// (multi-bill) menunggu semua lane kosong lalu jalan sendirian, jadi tidak balapan/menyalip.
+// ctx hanya mengontrol penerimaan pesan; command dijalankan dengan execCtx, jadi command yang
+// sedang jalan tetap bisa commit + publish status saat shutdown.
+// Saat ctx selesai / deliveries ditutup: berhenti terima, tunggu semua worker selesai, baru return.
+func Start(ctx, execCtx context.Context, log *utils.Logger, ch *amqp.Channel, queue string, h *dispatcher.Handler, opt Options) error {
+	workers := opt.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	// Batasi in-flight messages agar stabil (minimal cukup untuk semua worker)
+	prefetch := 10
+	if workers*2 > prefetch {
+		prefetch = workers * 2
+	}
+	if err := ch.Qos(prefetch, 0, false); err != nil {
 		log.Fail("set QoS failed", "err", err)
 	}
 
@@ -36,11 +79,46 @@ func Start(ctx context.Context, log *utils.Logger, ch *amqp.Channel, queue strin
 	if err != nil {
 		return err
 	}
-	log.OK("Consumer started", "queue", queue)
+	log.OK("Consumer started", "queue", queue, "workers", workers)
+	h.Metrics.SetConsumerRunning(true)
+	defer h.Metrics.SetConsumerRunning(false)
 
 	// Biar bisa berhenti rapi saat ctx selesai
 	go func() { <-ctx.Done(); _ = ch.Cancel(consumerTag, false) }()
 
+	run := func(j job) {
+		// sudah shutdown sebelum sempat diproses → kembalikan ke queue
+		if ctx.Err() != nil {
+			_ = j.d.Nack(false, true)
+			return
+		}
+		handle(execCtx, log, queue, h, opt, j)
+	}
+
+	lanes := make([]chan job, workers)
+	var wg sync.WaitGroup
+	var busy sync.WaitGroup // job yang sudah masuk lane tapi belum selesai (Add/Wait hanya dari loop ini)
+	for i := range lanes {
+		lanes[i] = make(chan job, prefetch)
+		wg.Add(1)
+		go func(lane <-chan job) {
+			defer wg.Done()
+			for j := range lane {
+				run(j)
+				busy.Done()
+			}
+		}(lanes[i])
+	}
+	// drain: tutup semua lane lalu tunggu worker selesai
+	defer func() {
+		for _, l := range lanes {
+			close(l)
+		}
+		wg.Wait()
+		log.OK("Consumer drained", "queue", queue)
+	}()
+
+	next := 0 // round-robin untuk command tanpa bill
 	for {
 		select {
 		case <-ctx.Done():
@@ -53,58 +131,114 @@ func Start(ctx context.Context, log *utils.Logger, ch *amqp.Channel, queue strin
 				return nil
 			}
 
-			func() {
-				// Safety net: jangan sampai panic matiin consumer
-				defer func() {
-					if r := recover(); r != nil {
-						log.Fail("panic in consumer", "recover", r)
-						_ = d.Nack(false, false) // drop
-					}
-				}()
-
-				var cmd types.Command
-				if err := unwrapToCommand(d.Body, &cmd); err != nil {
-					log.Fail("invalid message JSON", "err", err)
-					_ = d.Nack(false, false) // drop
-					return
+			var cmd types.Command
+			if err := unwrapToCommand(d.Body, &cmd); err != nil {
+				log.Fail("invalid message JSON", "err", err)
+				h.Metrics.MessageRejected("invalid_json")
+				quarantine(log, opt.Broker, queue, d, "invalid message JSON: "+err.Error(), "")
+				continue
+			}
+			cmd.Attempt = amqpc.RetryCount(d)
+
+			// Signature wajib kalau key dikonfigurasi; pesan tanpa/salah signature tidak dieksekusi.
+			// Tidak ada status ticket: ticketId-nya belum terverifikasi, jadi bisa saja milik ticket lain.
+			if opt.Keys != nil {
+				if err := opt.Keys.Verify(d.Body, d.Headers); err != nil {
+					log.Fail("⛔ signature rejected", "ticket", cmd.TicketID, "type", cmd.CommandType, "err", err)
+					h.Metrics.MessageRejected("signature")
+					quarantine(log, opt.Broker, queue, d, "signature: "+err.Error(), "")
+					continue
 				}
+			}
 
-				log.Info("📥 received",
-					"queue", queue,
-					"type", cmd.CommandType,
-					"ticket", cmd.TicketID,
-					"idStore", cmd.IDStore,
-				)
-
-				resp, _ := h.Dispatch(ctx, cmd) // dispatcher handle status publish
-
-				if resp.Status != "success" {
-					// ambil pesan error yang ramah
-					errText := ""
-					switch v := resp.Data.(type) {
-					case map[string]any:
-						if e, ok := v["error"]; ok {
-							errText = fmt.Sprint(e)
-						} else {
-							b, _ := json.Marshal(v)
-							errText = string(b)
-						}
-					default:
-						b, _ := json.Marshal(v)
-						errText = string(b)
-					}
-
-					log.Fail("processed (failed)",
-						"ticket", cmd.TicketID,
-						"type", cmd.CommandType,
-						"error", errText,
-					)
-				} else {
-					log.OK("processed", "ticket", cmd.TicketID, "status", resp.Status, "handler", resp.Handler)
-				}
+			if cmd.Exclusive() {
+				busy.Wait()
+				run(job{d: d, cmd: cmd})
+				continue
+			}
+
+			lane := next % workers
+			if key := cmd.BillKey(); key != "" {
+				lane = laneFor(key, workers)
+			} else {
+				next++
+			}
+			busy.Add(1)
+			lanes[lane] <- job{d: d, cmd: cmd}
+		}
+	}
+}
+
+func laneFor(key string, n int) int {
+	f := fnv.New32a()
+	_, _ = f.Write([]byte(key))
+	return int(f.Sum32() % uint32(n))
+}
+
+// handle: proses 1 command lalu ack (atau jadwalkan retry / DLQ).
+func handle(ctx context.Context, log *utils.Logger, queue string, h *dispatcher.Handler, opt Options, j job) {
+	d, cmd := j.d, j.cmd
 
-				_ = d.Ack(false)
-			}()
+	// Safety net: jangan sampai panic matiin consumer
+	defer func() {
+		if r := recover(); r != nil {
+			log.Fail("panic in consumer", "recover", r)
+			quarantine(log, opt.Broker, queue, d, fmt.Sprintf("panic: %v", r), string(debug.Stack()))
 		}
+	}()
+
+	log.Info("📥 received",
+		"queue", queue,
+		"type", cmd.CommandType,
+		"ticket", cmd.TicketID,
+		"idStore", cmd.IDStore,
+		"dryRun", cmd.DryRun,
+		"attempt", cmd.Attempt,
+	)
+
+	resp, _ := h.Dispatch(ctx, cmd) // dispatcher handle status publish
+
+	if resp.Status == types.StatusAborted {
+		_ = d.Nack(false, true)
+		log.Warn("↩️ interrupted, requeued", "ticket", cmd.TicketID)
+		return
 	}
+
+	if resp.Status == types.StatusRetry {
+		if err := opt.Broker.ScheduleRetry(queue, d, cmd.Attempt+1); err != nil {
+			// jangan requeue langsung (balik seketika & gagal lagi tanpa jeda) → DLQ, bisa di-requeue nanti
+			log.Fail("schedule retry failed", "ticket", cmd.TicketID, "err", err)
+			quarantine(log, opt.Broker, queue, d, "schedule retry failed: "+err.Error(), "")
+			return
+		}
+		log.Warn("🔁 retry scheduled", "ticket", cmd.TicketID, "attempt", cmd.Attempt+1)
+		return
+	}
+
+	if resp.Status != types.StatusSuccess {
+		// ambil pesan error yang ramah
+		errText := ""
+		switch v := resp.Data.(type) {
+		case map[string]any:
+			if e, ok := v["error"]; ok {
+				errText = fmt.Sprint(e)
+			} else {
+				b, _ := json.Marshal(v)
+				errText = string(b)
+			}
+		default:
+			b, _ := json.Marshal(v)
+			errText = string(b)
+		}
+
+		log.Fail("processed (failed)",
+			"ticket", cmd.TicketID,
+			"type", cmd.CommandType,
+			"error", errText,
+		)
+	} else {
+		log.OK("processed", "ticket", cmd.TicketID, "status", resp.Status, "handler", resp.Handler)
+	}
+
+	_ = d.Ack(false)
 }
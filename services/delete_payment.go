@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"CommandHandler/types"
+)
+
+// DeletePaymentLine: hapus 1 baris TR_SALES_PAYMENT_DETAIL yang salah, hapus juga
+// entri LOG_CASHDRAWER pasangannya, lalu reset status_kirim. Semua dalam 1 transaksi.
+func (s *Service) DeletePaymentLine(ctx context.Context, m Meta, p types.PayloadDeletePayment) (types.ResponseDeletePayment, error) {
+	// --- Validasi dasar ---
+	id, grandInt, err := parseBillRef(p.IDTRSalesHeader, p.GrandTotal)
+	if err != nil {
+		return types.ResponseDeletePayment{}, err
+	}
+	if strings.TrimSpace(p.PaymentType) == "" {
+		return types.ResponseDeletePayment{}, fmt.Errorf("missing paymentType")
+	}
+	paymentType := normalizePaymentType(p.PaymentType)
+
+	// --- Transaksi ---
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return types.ResponseDeletePayment{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }() // aman walau sudah commit
+
+	// (1) Cari billcode
+	b, err := findBill(ctx, tx, id, grandInt)
+	if err != nil {
+		return types.ResponseDeletePayment{}, err
+	}
+	billcode := b.ID
+
+	// (2) Ambil baris payment yang mau dihapus
+	var d paymentDetail
+	const q2 = `
+SELECT TOP 1
+  WAKTU_URUT,
+  CAST(BAYAR AS INT) AS BAYAR,
+  TIPE_BAYAR
+FROM TR_SALES_PAYMENT_DETAIL
+WHERE ID_TR_SALES_HEADER = @billcode
+  AND LTRIM(RTRIM(TIPE_BAYAR)) COLLATE SQL_Latin1_General_CP1_CI_AS
+      = LTRIM(RTRIM(@paymentType)) COLLATE SQL_Latin1_General_CP1_CI_AS
+ORDER BY WAKTU_URUT
+`
+	if scanErr := tx.QueryRowContext(
+		ctx, q2,
+		sql.Named("billcode", billcode),
+		sql.Named("paymentType", paymentType),
+	).Scan(&d.WaktuUrut, &d.Bayar, &d.TipeBayar); scanErr != nil {
+		if errors.Is(scanErr, sql.ErrNoRows) {
+			return types.ResponseDeletePayment{}, fmt.Errorf(
+				"payment detail not found: billcode=%s paymentType=%s available=%v",
+				billcode, paymentType, availablePaymentTypes(ctx, tx, billcode),
+			)
+		}
+		return types.ResponseDeletePayment{}, fmt.Errorf("query payment detail failed: %w", scanErr)
+	}
+
+	waktuUrut, bayar := d.WaktuUrut, d.Bayar
+
+	// policy: batas umur transaksi yang boleh diubah
+	if err := m.Policy.CheckDaysBack(waktuUrut, time.Now()); err != nil {
+		return types.ResponseDeletePayment{}, err
+	}
+
+	dateOnly := time.Date(waktuUrut.Year(), waktuUrut.Month(), waktuUrut.Day(), 0, 0, 0, 0, waktuUrut.Location())
+
+	// (3) Hapus baris payment (hanya 1 baris yang ketemu di atas)
+	q3 := `
+WITH TargetRow AS (
+  SELECT TOP 1 *
+  FROM TR_SALES_PAYMENT_DETAIL
+  WHERE ID_TR_SALES_HEADER = @billcode
+    AND ` + sameTime("WAKTU_URUT", "waktuUrut") + `
+    AND CAST(BAYAR AS INT) = @bayar
+    AND LTRIM(RTRIM(TIPE_BAYAR)) COLLATE SQL_Latin1_General_CP1_CI_AS
+        = LTRIM(RTRIM(@paymentType)) COLLATE SQL_Latin1_General_CP1_CI_AS
+)
+DELETE FROM TargetRow;
+`
+	res, err := tx.ExecContext(
+		ctx, q3,
+		sql.Named("billcode", billcode),
+		sql.Named("waktuUrut", waktuUrut),
+		sql.Named("bayar", bayar),
+		sql.Named("paymentType", paymentType),
+	)
+	if err != nil {
+		return types.ResponseDeletePayment{}, fmt.Errorf("delete payment detail failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return types.ResponseDeletePayment{}, fmt.Errorf("delete payment detail affected %d rows, expected 1", n)
+	}
+
+	// (4) Hapus LOG_CASHDRAWER pasangannya
+	keterangan := strings.TrimSpace(cashDrawerKeterangan(isOrderOnline(b.OrderOnline), paymentType))
+	const q4sel = `
+SELECT TOP 1 Tanggal, Keterangan
+FROM LOG_CASHDRAWER
+WHERE DATEDIFF(day, Tanggal, @date) = 0
+  AND CashIn = @bayar
+  AND LTRIM(RTRIM(Keterangan)) = @keterangan
+`
+	var tanggal time.Time
+	var keteranganLama string
+	if scanErr := tx.QueryRowContext(
+		ctx, q4sel,
+		sql.Named("date", dateOnly),
+		sql.Named("bayar", bayar),
+		sql.Named("keterangan", keterangan),
+	).Scan(&tanggal, &keteranganLama); scanErr != nil {
+		if errors.Is(scanErr, sql.ErrNoRows) {
+			return types.ResponseDeletePayment{}, fmt.Errorf(
+				"log cashdrawer not found: date=%s bayar=%d keterangan=%s",
+				dateOnly.Format("2006-01-02"), bayar, keterangan,
+			)
+		}
+		return types.ResponseDeletePayment{}, fmt.Errorf("query log cashdrawer failed: %w", scanErr)
+	}
+
+	q4del := `
+WITH TargetRow AS (
+  SELECT TOP 1 *
+  FROM LOG_CASHDRAWER
+  WHERE ` + sameTime("Tanggal", "tanggal") + `
+    AND CashIn = @bayar
+    AND LTRIM(RTRIM(Keterangan)) = @keterangan
+)
+DELETE FROM TargetRow;
+`
+	res, err = tx.ExecContext(
+		ctx, q4del,
+		sql.Named("tanggal", tanggal),
+		sql.Named("bayar", bayar),
+		sql.Named("keterangan", keterangan),
+	)
+	if err != nil {
+		return types.ResponseDeletePayment{}, fmt.Errorf("delete LOG_CASHDRAWER failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return types.ResponseDeletePayment{}, fmt.Errorf("delete LOG_CASHDRAWER affected %d rows, expected 1", n)
+	}
+
+	// (5) Reset status_kirim
+	const q5 = `
+UPDATE TR_SALES_HEADER
+SET status_kirim = '0'
+WHERE ID_TR_SALES_HEADER = @billcode
+`
+	if _, err = tx.ExecContext(ctx, q5, sql.Named("billcode", billcode)); err != nil {
+		return types.ResponseDeletePayment{}, fmt.Errorf("reset status_kirim failed: %w", err)
+	}
+
+	// Snapshot semua baris yang disentuh (After kosong = dihapus)
+	changes := []types.RowChange{
+		{
+			Table:  "TR_SALES_PAYMENT_DETAIL",
+			Key:    d.key(billcode),
+			Before: map[string]any{"TIPE_BAYAR": d.TipeBayar, "BAYAR": bayar},
+		},
+		{
+			Table:  "LOG_CASHDRAWER",
+			Key:    map[string]any{"Tanggal": tanggal, "CashIn": bayar},
+			Before: map[string]any{"Keterangan": keteranganLama},
+		},
+		headerChange(b, map[string]any{"status_kirim": "0"}),
+	}
+
+	// Audit trail (ikut transaksi; dry-run ikut ke-rollback)
+	if err = writeAudit(ctx, tx, m, changes); err != nil {
+		return types.ResponseDeletePayment{}, err
+	}
+
+	out := types.ResponseDeletePayment{
+		Billcode:      billcode,
+		TipeBayar:     paymentType,
+		Bayar:         bayar,
+		LogCashdrawer: keterangan,
+		DryRun:        m.DryRun,
+		Changes:       changes,
+	}
+
+	// Commit (atau rollback kalau dry-run)
+	if err = finish(ctx, tx, m, out); err != nil {
+		return types.ResponseDeletePayment{}, fmt.Errorf("commit failed: %w", err)
+	}
+	return out, nil
+}
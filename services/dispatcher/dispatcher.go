@@ -4,83 +4,311 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
+	"time"
 
 	services "CommandHandler/services"
+	"CommandHandler/services/monitor"
+	"CommandHandler/services/policy"
 	"CommandHandler/services/publisher"
 	"CommandHandler/types"
 	"CommandHandler/utils"
-
-	"github.com/streadway/amqp"
 )
 
+// DeadLetters: operasi DLQ (diimplementasi config/amqp.Client).
+type DeadLetters interface {
+	ListDeadLetters(ctx context.Context, limit int) ([]types.DeadLetter, error)
+	RequeueDeadLetters(ctx context.Context, limit int, ticketIDs []string) (requeued, skipped []types.DeadLetter, err error)
+}
+
 type Handler struct {
 	Log *utils.Logger
-	Ch  *amqp.Channel
+	Pub *publisher.Publisher
+	DLQ DeadLetters
 	Svc *services.Service
+
+	StoreID    string // store lokal (dari DT_STORE), ikut di status message
+	MaxRetries int    // retry maksimal untuk error transient; 0 = tidak ada retry
+
+	Metrics *monitor.Metrics // opsional (nil = tidak dicatat)
+	Policy  *policy.Policy   // opsional (nil = semua NIK diizinkan)
+
+	// Outbox: relay status message (wajib di-set). Status final ditulis ke tabel outbox, lalu Kick.
+	Outbox interface{ Kick() }
+
+	routes map[types.CommandType]route
 }
 
-func New(log *utils.Logger, ch *amqp.Channel, svc *services.Service) *Handler {
-	return &Handler{Log: log, Ch: ch, Svc: svc}
+func New(log *utils.Logger, pub *publisher.Publisher, dlq DeadLetters, svc *services.Service) *Handler {
+	h := &Handler{Log: log, Pub: pub, DLQ: dlq, Svc: svc, routes: map[types.CommandType]route{}}
+	registerRoutes(h)
+	return h
 }
 
+// Dispatch: decode → cek NIK → validate → run → publish status. Sama untuk semua route.
+// Status lifecycle yang di-publish: RECEIVED → PROCESSING → RETRYING / COMPLETED / FAILED.
 func (h *Handler) Dispatch(ctx context.Context, cmd types.Command) (types.CommonResponse, error) {
-	switch cmd.CommandType {
-
-	case types.CommandRepairPayment:
-		// Parse payload generic → struct yang benar
-		var p types.PayloadRepairPayment
-		b, _ := json.Marshal(cmd.Payload)
-		if err := json.Unmarshal(b, &p); err != nil {
-			_ = publisher.PublishTicketStatus(h.Log, h.Ch, cmd.TicketID, "", "FAILED")
-			return types.CommonResponse{
-				TypeCommand: types.CommandRepairPayment,
-				Handler:     "TransactionService",
-				Status:      "failed",
-				Data:        map[string]any{"error": "invalid payload"},
-			}, nil
+	start := time.Now()
+	h.Metrics.CommandReceived(string(cmd.CommandType))
+
+	resp, err := h.dispatch(ctx, cmd)
+	if resp.Status != types.StatusRetry && resp.Status != types.StatusAborted {
+		h.Metrics.CommandDone(string(cmd.CommandType), resp.Status == types.StatusSuccess, time.Since(start))
+	}
+	return resp, err
+}
+
+func (h *Handler) dispatch(ctx context.Context, cmd types.Command) (types.CommonResponse, error) {
+	// Command untuk store lain jangan pernah dieksekusi ke DB store ini
+	if h.StoreID != "" && !strings.EqualFold(strings.TrimSpace(cmd.IDStore), h.StoreID) {
+		return h.storeMismatch(cmd), nil
+	}
+
+	r, ok := h.routes[cmd.CommandType]
+	if !ok {
+		// Command tidak dikenal → mark failed, dan kembalikan error supaya terlihat sebagai kesalahan konfigurasi
+		msg := "unsupported command type: " + string(cmd.CommandType)
+		h.emit(cmd, types.TicketStatus{
+			Status:       types.TicketFailed,
+			Handler:      "UnknownHandler",
+			ErrorCode:    types.ErrCodeUnsupportedCommand,
+			ErrorMessage: msg,
+		})
+		return types.CommonResponse{
+			TypeCommand: cmd.CommandType,
+			Handler:     "UnknownHandler",
+			Status:      types.StatusFailed,
+			Data:        map[string]any{"error": msg, "code": types.ErrCodeUnsupportedCommand},
+		}, errors.New("unsupported command type")
+	}
+
+	// Ticket sudah pernah selesai (redelivery) → jangan jalankan lagi, publish ulang hasil lama
+	if !cmd.DryRun {
+		done, ok, err := h.Svc.LookupTicket(ctx, cmd.TicketID)
+		if err != nil {
+			h.Log.Warn("processed ticket lookup failed", "ticket", cmd.TicketID, "err", err)
+		} else if ok {
+			return h.replay(cmd, r.handler, done), nil
 		}
+	}
 
-		// NIK wajib
-		if strings.TrimSpace(p.SenderNIK) == "" {
-			_ = publisher.PublishTicketStatus(h.Log, h.Ch, cmd.TicketID, "", "FAILED")
-			return types.CommonResponse{
-				TypeCommand: types.CommandRepairPayment,
-				Handler:     "TransactionService",
-				Status:      "failed",
-				Data:        map[string]any{"error": "senderNik is required"},
-			}, nil
+	meta := func(nik string) services.Meta {
+		return services.Meta{
+			TicketID:    cmd.TicketID,
+			SenderNIK:   nik,
+			CommandType: cmd.CommandType,
+			DryRun:      cmd.DryRun,
+			StoreID:     h.StoreID,
+			Handler:     r.handler,
+			Attempt:     cmd.Attempt,
 		}
+	}
 
-		// Jalankan service
-		res, err := h.Svc.RepairPaymentMethod(ctx, p)
-		if err != nil {
-			_ = publisher.PublishTicketStatus(h.Log, h.Ch, cmd.TicketID, p.SenderNIK, "FAILED")
+	fail := func(nik, code, msg string) (types.CommonResponse, error) {
+		data := map[string]any{"error": msg, "code": code}
+		st := meta(nik).Status(types.TicketFailed)
+		st.ErrorCode = code
+		st.ErrorMessage = msg
+		h.finalize(cmd, st, func() error { return h.Svc.RecordFailure(ctx, meta(nik), data, st) })
+		return types.CommonResponse{
+			TypeCommand: cmd.CommandType,
+			Handler:     r.handler,
+			Status:      types.StatusFailed,
+			Data:        data,
+		}, nil
+	}
+
+	// Parse payload generic → struct yang benar
+	p, err := r.decode(cmd.Payload)
+	if err != nil {
+		return fail("", types.ErrCodeInvalidPayload, "invalid payload")
+	}
+	nik := strings.TrimSpace(p.Sender())
+
+	// RECEIVED cukup sekali (retry langsung PROCESSING)
+	if cmd.Attempt == 0 {
+		h.emit(cmd, types.TicketStatus{SenderNIK: nik, Status: types.TicketReceived, Handler: r.handler})
+	}
+
+	// NIK wajib
+	if nik == "" {
+		return fail("", types.ErrCodeMissingSender, "senderNik is required")
+	}
+
+	if err := r.validate(p); err != nil {
+		return fail(nik, types.ErrCodeValidation, err.Error())
+	}
+
+	// Otorisasi NIK per command type (+ batas grandTotal / pasangan payment)
+	req := r.policy(p)
+	req.NIK = nik
+	req.Command = cmd.CommandType
+	dec, err := h.Policy.Authorize(req)
+	if err != nil {
+		var denied *policy.Denied
+		if errors.As(err, &denied) {
+			h.Log.Warn("⛔ policy denied", "ticket", cmd.TicketID, "nik", nik, "code", denied.Code, "reason", denied.Reason)
+			return fail(nik, denied.Code, denied.Reason)
+		}
+		return fail(nik, types.ErrCodeExecution, err.Error())
+	}
+
+	// Jalankan service
+	h.emit(cmd, types.TicketStatus{SenderNIK: nik, Status: types.TicketProcessing, Handler: r.handler})
+	m := meta(nik)
+	m.Policy = dec // batas yang dicek service (mis. maxDaysBack)
+	res, err := r.run(ctx, m, p)
+	if err != nil {
+		// dibatalkan shutdown (grace period habis): transaksi sudah rollback, jangan dicatat FAILED
+		// → consumer requeue, command jalan lagi setelah restart
+		if ctx.Err() != nil {
+			h.Log.Warn("command interrupted by shutdown, will be redelivered", "ticket", cmd.TicketID, "err", err)
 			return types.CommonResponse{
-				TypeCommand: types.CommandRepairPayment,
-				Handler:     "TransactionService",
-				Status:      "failed",
+				TypeCommand: cmd.CommandType,
+				Handler:     r.handler,
+				Status:      types.StatusAborted,
 				Data:        map[string]any{"error": err.Error()},
 			}, nil
 		}
 
-		// Sukses
-		_ = publisher.PublishTicketStatus(h.Log, h.Ch, cmd.TicketID, p.SenderNIK, "COMPLETED")
-		return types.CommonResponse{
-			TypeCommand: types.CommandRepairPayment,
-			Handler:     "TransactionService",
-			Status:      "success",
-			Data:        res,
-		}, nil
+		// ditolak policy di dalam service (butuh data DB, mis. umur transaksi)
+		var denied *policy.Denied
+		if errors.As(err, &denied) {
+			h.Log.Warn("⛔ policy denied", "ticket", cmd.TicketID, "nik", nik, "code", denied.Code, "reason", denied.Reason)
+			return fail(nik, denied.Code, denied.Reason)
+		}
 
-	default:
-		// Command tidak dikenal → mark failed, dan kembalikan error supaya terlihat sebagai kesalahan konfigurasi
-		_ = publisher.PublishTicketStatus(h.Log, h.Ch, cmd.TicketID, "", "FAILED")
-		return types.CommonResponse{
-			TypeCommand: cmd.CommandType,
-			Handler:     "UnknownHandler",
-			Status:      "failed",
-			Data:        map[string]any{"error": "unsupported command type: " + string(cmd.CommandType)},
-		}, errors.New("unsupported command type")
+		// Error transient (deadlock, timeout, koneksi putus) → retry dulu, FAILED hanya kalau jatah habis
+		if services.IsTransient(err) {
+			if cmd.Attempt < h.MaxRetries {
+				h.Log.Warn("transient error, will retry",
+					"ticket", cmd.TicketID,
+					"attempt", cmd.Attempt+1,
+					"max", h.MaxRetries,
+					"err", err,
+				)
+				h.emit(cmd, types.TicketStatus{
+					SenderNIK:    nik,
+					Status:       types.TicketRetrying,
+					Handler:      r.handler,
+					ErrorCode:    types.ErrCodeTransient,
+					ErrorMessage: err.Error(),
+				})
+				return types.CommonResponse{
+					TypeCommand: cmd.CommandType,
+					Handler:     r.handler,
+					Status:      types.StatusRetry,
+					Data:        map[string]any{"error": err.Error(), "attempt": cmd.Attempt + 1},
+				}, nil
+			}
+			if cmd.Attempt > 0 {
+				return fail(nik, types.ErrCodeRetryExhausted, fmt.Sprintf("%v (after %d retries)", err, cmd.Attempt))
+			}
+			return fail(nik, types.ErrCodeTransient, err.Error())
+		}
+		return fail(nik, types.ErrCodeExecution, err.Error())
+	}
+
+	// Sukses, hasil ikut dikirim (dry-run: berisi diff preview).
+	// Route transaksional sudah menulis status ke outbox di dalam transaksinya.
+	st := meta(nik).Status(types.TicketCompleted)
+	st.Data = res
+	if r.noTx {
+		h.finalize(cmd, st, func() error { return h.Svc.RecordSuccess(ctx, meta(nik), res) })
+	} else {
+		h.finalize(cmd, st, nil)
+	}
+	return types.CommonResponse{
+		TypeCommand: cmd.CommandType,
+		Handler:     r.handler,
+		Status:      types.StatusSuccess,
+		Data:        res,
+	}, nil
+}
+
+// Reject: laporkan command yang ditolak sebelum dieksekusi (mis. store mismatch).
+// Tidak dicatat sebagai processed, supaya kiriman ulang yang valid tetap bisa jalan.
+func (h *Handler) Reject(cmd types.Command, code, msg string) {
+	h.emit(cmd, types.TicketStatus{
+		Status:       types.TicketFailed,
+		Handler:      "Consumer",
+		ErrorCode:    code,
+		ErrorMessage: msg,
+	})
+}
+
+// storeMismatch: tolak command yang idStore-nya bukan store lokal (salah routing / replay).
+// Tidak dicatat sebagai processed: ticket itu milik store lain.
+func (h *Handler) storeMismatch(cmd types.Command) types.CommonResponse {
+	msg := fmt.Sprintf("idStore %q does not match local store %q", cmd.IDStore, h.StoreID)
+	h.Log.Fail("🚨 ALERT store mismatch, command rejected",
+		"ticket", cmd.TicketID,
+		"type", cmd.CommandType,
+		"idStore", cmd.IDStore,
+		"localStore", h.StoreID,
+	)
+	h.Metrics.StoreMismatch(cmd.IDStore)
+	h.Reject(cmd, types.ErrCodeStoreMismatch, msg)
+	return types.CommonResponse{
+		TypeCommand: cmd.CommandType,
+		Handler:     "Consumer",
+		Status:      types.StatusFailed,
+		Data:        map[string]any{"error": msg, "code": types.ErrCodeStoreMismatch},
+	}
+}
+
+// finalize: status final dikirim lewat outbox. record menulis baris outbox (nil = sudah ditulis
+// service di dalam transaksinya). Dry-run / ticket tanpa ID tidak disimpan → publish langsung.
+func (h *Handler) finalize(cmd types.Command, st types.TicketStatus, record func() error) {
+	if cmd.DryRun || strings.TrimSpace(cmd.TicketID) == "" {
+		h.emit(cmd, st)
+		return
+	}
+	if record != nil {
+		if err := record(); err != nil {
+			h.Log.Warn("record ticket failed, publish directly", "ticket", cmd.TicketID, "err", err)
+			h.emit(cmd, st)
+			return
+		}
+	}
+	h.Outbox.Kick()
+}
+
+// emit: publish status ticket; field umum (ticket, store, command, attempt, dryRun) diisi dari cmd.
+// Error publish cukup di-log (sudah di-log di publisher).
+func (h *Handler) emit(cmd types.Command, st types.TicketStatus) {
+	st.TicketID = cmd.TicketID
+	st.StoreID = h.StoreID
+	st.CommandType = cmd.CommandType
+	st.Attempt = cmd.Attempt
+	st.DryRun = cmd.DryRun
+	_ = h.Pub.PublishStatus(context.Background(), st)
+}
+
+// replay: publish ulang status ticket yang sudah tersimpan, tanpa menjalankan command.
+func (h *Handler) replay(cmd types.Command, handler string, done services.ProcessedTicket) types.CommonResponse {
+	h.Log.Warn("duplicate ticket, skip execution", "ticket", done.TicketID, "status", done.Status)
+
+	st := types.TicketStatus{SenderNIK: done.SenderNIK, Status: done.Status, Handler: handler}
+	resp := types.CommonResponse{
+		TypeCommand: cmd.CommandType,
+		Handler:     handler,
+		Status:      types.StatusSuccess,
+		Data:        done.Result,
+	}
+	if done.Status != types.TicketCompleted {
+		resp.Status = types.StatusFailed
+		// bentuk sama dengan respons gagal biasa: map {"error": ..., "code": ...}
+		var m map[string]any
+		if err := json.Unmarshal(done.Result, &m); err == nil {
+			resp.Data = m
+			st.ErrorCode, _ = m["code"].(string)
+			st.ErrorMessage, _ = m["error"].(string)
+		}
+	} else {
+		st.Data = done.Result
 	}
+	h.emit(cmd, st)
+	return resp
 }
@@ -0,0 +1,122 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	services "CommandHandler/services"
+	"CommandHandler/services/publisher"
+	"CommandHandler/types"
+	"CommandHandler/utils"
+)
+
+// newTestHandler: handler tanpa DB/broker; publisher belum dibuka jadi emit hanya gagal di-log.
+func newTestHandler() *Handler {
+	log := utils.NewLogger()
+	return &Handler{Log: log, Pub: publisher.New(log), routes: map[types.CommandType]route{}}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	run := func(context.Context, services.Meta, types.PayloadDeadLetters) (any, error) { return nil, nil }
+	tests := []struct {
+		name  string
+		setup func(h *Handler)
+	}{
+		{name: "missing Run", setup: func(h *Handler) {
+			Register(h, "TEST", Route[types.PayloadDeadLetters]{Handler: "Test"})
+		}},
+		{name: "duplicate type", setup: func(h *Handler) {
+			Register(h, "TEST", Route[types.PayloadDeadLetters]{Run: run})
+			Register(h, "TEST", Route[types.PayloadDeadLetters]{Run: run})
+		}},
+		{name: "duplicate of a built-in route", setup: func(h *Handler) {
+			registerRoutes(h)
+			Register(h, types.CommandListDeadLetters, Route[types.PayloadDeadLetters]{Run: run})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("Register did not panic")
+				}
+			}()
+			tt.setup(newTestHandler())
+		})
+	}
+}
+
+func TestDispatchUnknownType(t *testing.T) {
+	h := newTestHandler()
+	registerRoutes(h)
+
+	resp, err := h.Dispatch(context.Background(), types.Command{TicketID: "T1", CommandType: "NOT_A_COMMAND"})
+	if err == nil {
+		t.Fatal("Dispatch error = nil, want unsupported command type")
+	}
+	if resp.Status != types.StatusFailed {
+		t.Fatalf("status = %s, want %s", resp.Status, types.StatusFailed)
+	}
+	data, _ := resp.Data.(map[string]any)
+	if data["code"] != types.ErrCodeUnsupportedCommand {
+		t.Fatalf("data = %v, want code %s", resp.Data, types.ErrCodeUnsupportedCommand)
+	}
+}
+
+func TestDispatchRoute(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  any
+		wantCode string // "" = sukses
+		wantRun  bool
+	}{
+		{name: "decoded payload reaches Run", payload: map[string]any{"senderNik": " 111 ", "limit": 5}, wantRun: true},
+		{name: "missing sender", payload: map[string]any{"limit": 5}, wantCode: types.ErrCodeMissingSender},
+		{name: "validate rejects", payload: map[string]any{"senderNik": "111", "limit": -1}, wantCode: types.ErrCodeValidation},
+		{name: "payload of the wrong shape", payload: map[string]any{"senderNik": "111", "limit": "many"}, wantCode: types.ErrCodeInvalidPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler()
+			var got *types.PayloadDeadLetters
+			var gotMeta services.Meta
+			Register(h, "TEST", Route[types.PayloadDeadLetters]{
+				Handler: "TestService",
+				NoTx:    true,
+				Validate: func(p types.PayloadDeadLetters) error {
+					if p.Limit < 0 {
+						return errors.New("limit must be >= 0")
+					}
+					return nil
+				},
+				Run: func(_ context.Context, m services.Meta, p types.PayloadDeadLetters) (any, error) {
+					got, gotMeta = &p, m
+					return "ok", nil
+				},
+			})
+
+			// dry-run: tidak menyentuh tabel processed/outbox
+			resp, err := h.Dispatch(context.Background(), types.Command{TicketID: "T1", CommandType: "TEST", Payload: tt.payload, DryRun: true})
+			if err != nil {
+				t.Fatalf("Dispatch error = %v", err)
+			}
+			if (got != nil) != tt.wantRun {
+				t.Fatalf("Run called = %v, want %v", got != nil, tt.wantRun)
+			}
+			if tt.wantCode == "" {
+				if resp.Status != types.StatusSuccess || resp.Handler != "TestService" || resp.Data != "ok" {
+					t.Fatalf("resp = %+v, want success from TestService", resp)
+				}
+				if got.Limit != 5 || gotMeta.SenderNIK != "111" || !gotMeta.DryRun || gotMeta.TicketID != "T1" {
+					t.Fatalf("Run got payload %+v meta %+v", got, gotMeta)
+				}
+				return
+			}
+			data, _ := resp.Data.(map[string]any)
+			if resp.Status != types.StatusFailed || data["code"] != tt.wantCode {
+				t.Fatalf("resp = %+v, want failed with %s", resp, tt.wantCode)
+			}
+		})
+	}
+}
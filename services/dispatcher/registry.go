@@ -0,0 +1,78 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	services "CommandHandler/services"
+	"CommandHandler/services/policy"
+	"CommandHandler/types"
+)
+
+// Route: definisi 1 command type (payload sudah di-decode ke struct yang benar).
+type Route[P types.Payload] struct {
+	Handler  string                                                       // nama handler di CommonResponse
+	Validate func(p P) error                                              // opsional, dijalankan setelah cek NIK
+	Run      func(ctx context.Context, m services.Meta, p P) (any, error) // wajib
+
+	// Policy: fakta payload untuk dicek policy (grandTotal, from/to payment). Opsional;
+	// NIK & command type diisi dispatcher.
+	Policy func(p P) policy.Request
+
+	// NoTx: Run tidak menutup transaksi lewat services (tidak menulis processed/outbox sendiri),
+	// jadi status COMPLETED dicatat dispatcher.
+	NoTx bool
+}
+
+// route: bentuk non-generic yang disimpan di registry.
+type route struct {
+	handler  string
+	noTx     bool
+	decode   func(raw any) (types.Payload, error)
+	validate func(p types.Payload) error
+	policy   func(p types.Payload) policy.Request
+	run      func(ctx context.Context, m services.Meta, p types.Payload) (any, error)
+}
+
+// Register mendaftarkan handler untuk satu command type. Register ulang type yang sama = panic
+// (kesalahan wiring, harus ketahuan saat startup).
+func Register[P types.Payload](h *Handler, t types.CommandType, r Route[P]) {
+	if r.Run == nil {
+		panic(fmt.Sprintf("dispatcher: route %s without Run", t))
+	}
+	if _, dup := h.routes[t]; dup {
+		panic(fmt.Sprintf("dispatcher: route %s registered twice", t))
+	}
+
+	h.routes[t] = route{
+		handler: r.Handler,
+		noTx:    r.NoTx,
+		decode: func(raw any) (types.Payload, error) {
+			var p P
+			b, err := json.Marshal(raw)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(b, &p); err != nil {
+				return nil, err
+			}
+			return p, nil
+		},
+		validate: func(p types.Payload) error {
+			if r.Validate == nil {
+				return nil
+			}
+			return r.Validate(p.(P))
+		},
+		policy: func(p types.Payload) policy.Request {
+			if r.Policy == nil {
+				return policy.Request{}
+			}
+			return r.Policy(p.(P))
+		},
+		run: func(ctx context.Context, m services.Meta, p types.Payload) (any, error) {
+			return r.Run(ctx, m, p.(P))
+		},
+	}
+}
@@ -0,0 +1,199 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	services "CommandHandler/services"
+	"CommandHandler/services/policy"
+	"CommandHandler/types"
+	"CommandHandler/utils"
+)
+
+// registerRoutes: daftar semua command yang di-handle agent ini.
+// Command baru cukup ditambah di sini, tanpa menyentuh Dispatch.
+func registerRoutes(h *Handler) {
+	Register(h, types.CommandRepairPayment, Route[types.PayloadRepairPayment]{
+		Handler: "TransactionService",
+		Validate: func(p types.PayloadRepairPayment) error {
+			if strings.TrimSpace(p.FromPaymentType) == "" || strings.TrimSpace(p.ToPaymentType) == "" {
+				return fmt.Errorf("fromPaymentType and toPaymentType are required")
+			}
+			return nil
+		},
+		Policy: func(p types.PayloadRepairPayment) policy.Request {
+			return policy.Request{
+				GrandTotal:  atoi(p.GrandTotal),
+				FromPayment: p.FromPaymentType,
+				ToPayment:   p.ToPaymentType,
+			}
+		},
+		Run: func(ctx context.Context, m services.Meta, p types.PayloadRepairPayment) (any, error) {
+			return h.Svc.RepairPaymentMethod(ctx, m, p)
+		},
+	})
+
+	Register(h, types.CommandDeletePayment, Route[types.PayloadDeletePayment]{
+		Handler: "TransactionService",
+		Validate: func(p types.PayloadDeletePayment) error {
+			if strings.TrimSpace(p.PaymentType) == "" {
+				return fmt.Errorf("paymentType is required")
+			}
+			return nil
+		},
+		Policy: func(p types.PayloadDeletePayment) policy.Request {
+			return policy.Request{GrandTotal: atoi(p.GrandTotal), FromPayment: p.PaymentType}
+		},
+		Run: func(ctx context.Context, m services.Meta, p types.PayloadDeletePayment) (any, error) {
+			return h.Svc.DeletePaymentLine(ctx, m, p)
+		},
+	})
+
+	Register(h, types.CommandSplitPayment, Route[types.PayloadSplitPayment]{
+		Handler: "TransactionService",
+		Validate: func(p types.PayloadSplitPayment) error {
+			if strings.TrimSpace(p.FromPaymentType) == "" {
+				return fmt.Errorf("fromPaymentType is required")
+			}
+			if len(p.Lines) < 2 {
+				return fmt.Errorf("at least 2 lines are required")
+			}
+			for i, l := range p.Lines {
+				if _, err := utils.GetPaymentValue(l.PaymentType); err != nil {
+					return fmt.Errorf("lines[%d]: %w", i, err)
+				}
+				if l.Amount <= 0 {
+					return fmt.Errorf("lines[%d]: amount must be > 0", i)
+				}
+			}
+			return nil
+		},
+		Policy: func(p types.PayloadSplitPayment) policy.Request {
+			req := policy.Request{GrandTotal: atoi(p.GrandTotal), FromPayment: p.FromPaymentType}
+			for _, l := range p.Lines {
+				req.ToPayments = append(req.ToPayments, l.PaymentType)
+			}
+			return req
+		},
+		Run: func(ctx context.Context, m services.Meta, p types.PayloadSplitPayment) (any, error) {
+			return h.Svc.SplitPayment(ctx, m, p)
+		},
+	})
+
+	Register(h, types.CommandSetOrderOnline, Route[types.PayloadSetOrderOnline]{
+		Handler: "TransactionService",
+		Validate: func(p types.PayloadSetOrderOnline) error {
+			if p.DirectSelling == nil {
+				return fmt.Errorf("directSelling is required")
+			}
+			return nil
+		},
+		Policy: func(p types.PayloadSetOrderOnline) policy.Request {
+			return policy.Request{GrandTotal: atoi(p.GrandTotal)}
+		},
+		Run: func(ctx context.Context, m services.Meta, p types.PayloadSetOrderOnline) (any, error) {
+			return h.Svc.SetOrderOnline(ctx, m, p)
+		},
+	})
+
+	Register(h, types.CommandReconcileCashdrawer, Route[types.PayloadReconcileCashdrawer]{
+		Handler: "ReportService",
+		NoTx:    true, // read-only
+		Validate: func(p types.PayloadReconcileCashdrawer) error {
+			if strings.TrimSpace(p.Date) == "" {
+				return fmt.Errorf("date is required")
+			}
+			return nil
+		},
+		Run: func(ctx context.Context, m services.Meta, p types.PayloadReconcileCashdrawer) (any, error) {
+			return h.Svc.ReconcileCashdrawer(ctx, p)
+		},
+	})
+
+	Register(h, types.CommandFixCashdrawer, Route[types.PayloadFixCashdrawer]{
+		Handler: "TransactionService",
+		Validate: func(p types.PayloadFixCashdrawer) error {
+			if strings.TrimSpace(p.Date) == "" {
+				return fmt.Errorf("date is required")
+			}
+			if p.MaxRows < 0 {
+				return fmt.Errorf("maxRows must be >= 0")
+			}
+			return nil
+		},
+		Run: func(ctx context.Context, m services.Meta, p types.PayloadFixCashdrawer) (any, error) {
+			return h.Svc.FixCashdrawer(ctx, m, p)
+		},
+	})
+
+	Register(h, types.CommandRevertTicket, Route[types.PayloadRevertTicket]{
+		Handler: "TransactionService",
+		Validate: func(p types.PayloadRevertTicket) error {
+			if strings.TrimSpace(p.TargetTicketID) == "" {
+				return fmt.Errorf("targetTicketId is required")
+			}
+			return nil
+		},
+		Run: func(ctx context.Context, m services.Meta, p types.PayloadRevertTicket) (any, error) {
+			return h.Svc.RevertTicket(ctx, m, p)
+		},
+	})
+
+	Register(h, types.CommandResend, Route[types.PayloadResendTransaction]{
+		Handler: "TransactionService",
+		Validate: func(p types.PayloadResendTransaction) error {
+			byBill := strings.TrimSpace(p.IDTRSalesHeader) != "" || len(p.Billcodes) > 0
+			byDate := strings.TrimSpace(p.DateFrom) != ""
+			if byBill == byDate {
+				return fmt.Errorf("exactly one of ID_TR_SALES_HEADER/billcodes or dateFrom is required")
+			}
+			if p.MaxRows < 0 {
+				return fmt.Errorf("maxRows must be >= 0")
+			}
+			return nil
+		},
+		Run: func(ctx context.Context, m services.Meta, p types.PayloadResendTransaction) (any, error) {
+			return h.Svc.ResendTransaction(ctx, m, p)
+		},
+	})
+
+	Register(h, types.CommandListDeadLetters, Route[types.PayloadDeadLetters]{
+		Handler: "DeadLetterService",
+		NoTx:    true,
+		Run: func(ctx context.Context, m services.Meta, p types.PayloadDeadLetters) (any, error) {
+			msgs, err := h.DLQ.ListDeadLetters(ctx, p.Limit)
+			if err != nil {
+				return nil, err
+			}
+			return types.ResponseDeadLetters{Count: len(msgs), Messages: msgs}, nil
+		},
+	})
+
+	Register(h, types.CommandRequeueDeadLetters, Route[types.PayloadDeadLetters]{
+		Handler: "DeadLetterService",
+		NoTx:    true,
+		Run: func(ctx context.Context, m services.Meta, p types.PayloadDeadLetters) (any, error) {
+			// dry-run: cukup tampilkan isi DLQ
+			fn := h.DLQ.RequeueDeadLetters
+			if m.DryRun {
+				fn = func(ctx context.Context, limit int, _ []string) ([]types.DeadLetter, []types.DeadLetter, error) {
+					msgs, err := h.DLQ.ListDeadLetters(ctx, limit)
+					return msgs, nil, err
+				}
+			}
+			msgs, skipped, err := fn(ctx, p.Limit, p.TicketIDs)
+			if err != nil {
+				return nil, err
+			}
+			return types.ResponseDeadLetters{Count: len(msgs), Messages: msgs, Skipped: skipped}, nil
+		},
+	})
+}
+
+// atoi: grandTotal string → int untuk policy (invalid → 0, nanti ditolak service).
+func atoi(s string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+)
+
+// Nomor error SQL Server yang biasanya hilang sendiri kalau dicoba lagi.
+var transientSQLErrors = map[int32]bool{
+	1205:  true, // deadlock victim
+	1222:  true, // lock request time out
+	-2:    true, // timeout expired
+	233:   true, // connection closed by server
+	10053: true, // transport-level error (connection aborted)
+	10054: true, // transport-level error (connection reset)
+	10060: true, // connection timeout
+	40613: true, // database not currently available
+	40501: true, // service busy
+	49918: true, // not enough resources
+}
+
+// IsTransient: true kalau error kemungkinan sementara (deadlock, lock timeout, timeout, koneksi putus),
+// jadi command boleh dicoba ulang. Error bisnis (billcode not found, dll) → false.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	// dibatalkan karena shutdown bukan error transient yang perlu di-retry
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var sqlErr mssql.Error
+	if errors.As(err, &sqlErr) {
+		for _, e := range append([]mssql.Error{sqlErr}, sqlErr.All...) {
+			if transientSQLErrors[e.Number] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "business error", err: errors.New("billcode not found"), want: false},
+		{name: "canceled by shutdown", err: fmt.Errorf("exec: %w", context.Canceled), want: false},
+		{name: "deadline exceeded", err: fmt.Errorf("exec: %w", context.DeadlineExceeded), want: true},
+		{name: "bad conn", err: driver.ErrBadConn, want: true},
+		{name: "conn done", err: sql.ErrConnDone, want: true},
+		{name: "eof", err: fmt.Errorf("read: %w", io.EOF), want: true},
+		{name: "connection reset", err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}, want: true},
+		{name: "net error", err: &net.DNSError{Err: "no such host", Name: "db"}, want: true},
+		{name: "deadlock victim", err: fmt.Errorf("update: %w", mssql.Error{Number: 1205}), want: true},
+		{name: "lock timeout", err: mssql.Error{Number: 1222}, want: true},
+		{
+			name: "transient number in All",
+			err:  mssql.Error{Number: 3621, All: []mssql.Error{{Number: 3621}, {Number: 1205}}},
+			want: true,
+		},
+		{name: "constraint violation", err: mssql.Error{Number: 2627}, want: false},
+		{name: "invalid column", err: mssql.Error{Number: 207}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.want {
+				t.Fatalf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
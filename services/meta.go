@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"CommandHandler/services/policy"
+	"CommandHandler/types"
+)
+
+// Meta: info command yang ikut dibawa dari dispatcher ke service.
+type Meta struct {
+	TicketID    string
+	SenderNIK   string
+	CommandType types.CommandType
+	DryRun      bool // true → semua query tetap jalan, tapi transaksi selalu di-rollback
+
+	// batas policy yang butuh data DB (mis. umur transaksi), sudah diputuskan dispatcher
+	Policy policy.Decision
+
+	// untuk status message final yang ditulis ke outbox
+	StoreID string
+	Handler string
+	Attempt int
+}
+
+// Status: status message ticket ini (field umum sudah terisi).
+func (m Meta) Status(status string) types.TicketStatus {
+	return types.TicketStatus{
+		TicketID:    m.TicketID,
+		SenderNIK:   m.SenderNIK,
+		Status:      status,
+		StoreID:     m.StoreID,
+		CommandType: m.CommandType,
+		Handler:     m.Handler,
+		Attempt:     m.Attempt,
+		DryRun:      m.DryRun,
+	}
+}
+
+// finish: tandai ticket COMPLETED + tulis status ke outbox (di transaksi yang sama) lalu commit.
+// Dry-run → rollback, tidak ada yang tersimpan (status dikirim langsung oleh dispatcher).
+func finish(ctx context.Context, tx *sql.Tx, m Meta, result any) error {
+	if m.DryRun {
+		return tx.Rollback()
+	}
+	if err := recordDone(ctx, tx, m, types.TicketCompleted, result, m.Status(types.TicketCompleted)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func recordDone(ctx context.Context, db execer, m Meta, status string, result any, st types.TicketStatus) error {
+	if strings.TrimSpace(m.TicketID) == "" {
+		return nil
+	}
+	if err := insertProcessed(ctx, db, m, status, result); err != nil {
+		return err
+	}
+	if status == types.TicketCompleted {
+		st.Data = result
+	}
+	return insertOutbox(ctx, db, st)
+}
+
+// RecordSuccess: untuk command yang tidak punya transaksi DB sendiri (mis. operasi DLQ).
+func (s *Service) RecordSuccess(ctx context.Context, m Meta, result any) error {
+	return s.record(ctx, m, types.TicketCompleted, result, m.Status(types.TicketCompleted))
+}
+
+// RecordFailure menyimpan ticket FAILED + status-nya ke outbox (di luar transaksi command,
+// karena transaksinya sudah rollback). st = status message FAILED lengkap dengan error code.
+func (s *Service) RecordFailure(ctx context.Context, m Meta, result any, st types.TicketStatus) error {
+	return s.record(ctx, m, types.TicketFailed, result, st)
+}
+
+func (s *Service) record(ctx context.Context, m Meta, status string, result any, st types.TicketStatus) error {
+	if m.DryRun || strings.TrimSpace(m.TicketID) == "" {
+		return fmt.Errorf("ticket cannot be recorded (dryRun=%v)", m.DryRun)
+	}
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := recordDone(ctx, tx, m, status, result, st); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
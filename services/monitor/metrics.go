@@ -0,0 +1,186 @@
+package monitor
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics: counter & histogram sederhana, di-expose dalam format teks Prometheus.
+// Semua method aman dipanggil pada *Metrics nil (metrics tidak aktif).
+type Metrics struct {
+	mu        sync.Mutex
+	received  map[string]uint64
+	completed map[string]uint64
+	failed    map[string]uint64
+	latency   map[string]*histogram
+	confirms  map[string]uint64
+	rejected  map[string]uint64
+	mismatch  map[string]uint64 // per idStore di pesan
+
+	consumerRunning atomic.Int32
+}
+
+// bucket latency (detik)
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type histogram struct {
+	counts []uint64 // per bucket (kumulatif dihitung saat render)
+	sum    float64
+	count  uint64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		received:  map[string]uint64{},
+		completed: map[string]uint64{},
+		failed:    map[string]uint64{},
+		latency:   map[string]*histogram{},
+		confirms:  map[string]uint64{},
+		rejected:  map[string]uint64{},
+		mismatch:  map[string]uint64{},
+	}
+}
+
+func (m *Metrics) CommandReceived(cmdType string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.received[cmdType]++
+	m.mu.Unlock()
+}
+
+// CommandDone: catat hasil akhir (completed / failed) + durasi proses.
+func (m *Metrics) CommandDone(cmdType string, ok bool, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ok {
+		m.completed[cmdType]++
+	} else {
+		m.failed[cmdType]++
+	}
+	h := m.latency[cmdType]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latency[cmdType] = h
+	}
+	sec := d.Seconds()
+	for i, b := range latencyBuckets {
+		if sec <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += sec
+	h.count++
+}
+
+// PublishConfirm: outcome = ack / nack / returned / timeout / error
+func (m *Metrics) PublishConfirm(outcome string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.confirms[outcome]++
+	m.mu.Unlock()
+}
+
+// MessageRejected: pesan ditolak sebelum dieksekusi (reason mis. invalid_json, signature).
+func (m *Metrics) MessageRejected(reason string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.rejected[reason]++
+	m.mu.Unlock()
+}
+
+// StoreMismatch: command untuk store lain sampai di queue store ini (salah routing / replay).
+// Dasar alert: cmdhandler_store_mismatch_total > 0.
+func (m *Metrics) StoreMismatch(msgStore string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.rejected["store_mismatch"]++
+	m.mismatch[msgStore]++
+	m.mu.Unlock()
+}
+
+func (m *Metrics) SetConsumerRunning(running bool) {
+	if m == nil {
+		return
+	}
+	var v int32
+	if running {
+		v = 1
+	}
+	m.consumerRunning.Store(v)
+}
+
+func (m *Metrics) ConsumerRunning() bool {
+	return m != nil && m.consumerRunning.Load() == 1
+}
+
+// Render: render format teks Prometheus (exposition format 0.0.4).
+func (m *Metrics) Render(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counter := func(name, help, label string, vals map[string]uint64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for _, k := range sortedKeys(vals) {
+			fmt.Fprintf(w, "%s{%s=%q} %d\n", name, label, k, vals[k])
+		}
+	}
+	counter("cmdhandler_commands_received_total", "Commands received per command type.", "command_type", m.received)
+	counter("cmdhandler_commands_completed_total", "Commands completed per command type.", "command_type", m.completed)
+	counter("cmdhandler_commands_failed_total", "Commands failed per command type.", "command_type", m.failed)
+	counter("cmdhandler_messages_rejected_total", "Messages rejected before execution per reason.", "reason", m.rejected)
+	counter("cmdhandler_store_mismatch_total", "Commands rejected because idStore is not the local store.", "message_store", m.mismatch)
+	counter("cmdhandler_publish_confirms_total", "Status publish outcomes (ack, nack, returned, timeout, error).", "outcome", m.confirms)
+
+	const hname = "cmdhandler_command_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Command processing latency.\n# TYPE %s histogram\n", hname, hname)
+	types := make([]string, 0, len(m.latency))
+	for k := range m.latency {
+		types = append(types, k)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		h := m.latency[t]
+		var cum uint64
+		for i, b := range latencyBuckets {
+			cum += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket{command_type=%q,le=%q} %d\n", hname, t, trimFloat(b), cum)
+		}
+		fmt.Fprintf(w, "%s_bucket{command_type=%q,le=\"+Inf\"} %d\n", hname, t, h.count)
+		fmt.Fprintf(w, "%s_sum{command_type=%q} %g\n", hname, t, h.sum)
+		fmt.Fprintf(w, "%s_count{command_type=%q} %d\n", hname, t, h.count)
+	}
+
+	fmt.Fprintf(w, "# HELP cmdhandler_consumer_running 1 if the consumer is consuming.\n# TYPE cmdhandler_consumer_running gauge\n")
+	fmt.Fprintf(w, "cmdhandler_consumer_running %d\n", m.consumerRunning.Load())
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func trimFloat(f float64) string {
+	s := fmt.Sprintf("%g", f)
+	return strings.TrimSuffix(s, ".0")
+}
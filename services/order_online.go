@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"CommandHandler/types"
+	"CommandHandler/utils"
+)
+
+// SetOrderOnline: ubah TR_SALES_HEADER.order_online tanpa menyentuh tipe bayar. Entri LOG_CASHDRAWER
+// tiap baris payment dipindah antara "Online" dan deskripsi tipe bayar, lalu status_kirim di-reset.
+func (s *Service) SetOrderOnline(ctx context.Context, m Meta, p types.PayloadSetOrderOnline) (types.ResponseSetOrderOnline, error) {
+	// --- Validasi dasar ---
+	id, grandInt, err := parseBillRef(p.IDTRSalesHeader, p.GrandTotal)
+	if err != nil {
+		return types.ResponseSetOrderOnline{}, err
+	}
+	if p.DirectSelling == nil {
+		return types.ResponseSetOrderOnline{}, fmt.Errorf("directSelling is required")
+	}
+	online := *p.DirectSelling
+
+	// --- Transaksi ---
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return types.ResponseSetOrderOnline{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }() // aman walau sudah commit
+
+	// (1) Cari billcode
+	b, err := findBill(ctx, tx, id, grandInt)
+	if err != nil {
+		return types.ResponseSetOrderOnline{}, err
+	}
+	billcode := b.ID
+	oldOnline := isOrderOnline(b.OrderOnline)
+	if oldOnline == online {
+		return types.ResponseSetOrderOnline{}, fmt.Errorf("order_online of %s is already %s", billcode, utils.IsDirectSelling(online))
+	}
+
+	// (2) Semua baris payment bill ini (sumber Keterangan LOG_CASHDRAWER)
+	const q2 = `
+SELECT
+  WAKTU_URUT,
+  CAST(BAYAR AS INT) AS BAYAR,
+  TIPE_BAYAR
+FROM TR_SALES_PAYMENT_DETAIL
+WHERE ID_TR_SALES_HEADER = @billcode
+ORDER BY WAKTU_URUT
+`
+	details, err := queryPaymentDetails(ctx, tx, q2, sql.Named("billcode", billcode))
+	if err != nil {
+		return types.ResponseSetOrderOnline{}, fmt.Errorf("query payment detail failed: %w", err)
+	}
+	if len(details) == 0 {
+		return types.ResponseSetOrderOnline{}, fmt.Errorf("payment detail not found: billcode=%s", billcode)
+	}
+
+	// policy: batas umur transaksi yang boleh diubah
+	if err := m.Policy.CheckDaysBack(details[0].WaktuUrut, time.Now()); err != nil {
+		return types.ResponseSetOrderOnline{}, err
+	}
+
+	// (3) Update order_online
+	directSelling := utils.IsDirectSelling(online)
+	const q3 = `
+UPDATE TR_SALES_HEADER
+SET order_online = @directSelling
+WHERE ID_TR_SALES_HEADER = @billcode
+`
+	if _, err = tx.ExecContext(
+		ctx, q3,
+		sql.Named("billcode", billcode),
+		sql.Named("directSelling", directSelling),
+	); err != nil {
+		return types.ResponseSetOrderOnline{}, fmt.Errorf("update order_online failed: %w", err)
+	}
+
+	// (4) Pindahkan LOG_CASHDRAWER tiap baris payment. Baris yang sudah diubah tidak cocok
+	// lagi dengan Keterangan lama, jadi 2 payment dengan tipe & nominal sama tetap kena 2 baris berbeda.
+	var changes []types.RowChange
+	var logs []string
+	for _, d := range details {
+		tipe := strings.TrimSpace(d.TipeBayar)
+		keteranganLama := strings.TrimSpace(cashDrawerKeterangan(oldOnline, tipe))
+		keteranganBaru := strings.TrimSpace(cashDrawerKeterangan(online, tipe))
+		dateOnly := time.Date(d.WaktuUrut.Year(), d.WaktuUrut.Month(), d.WaktuUrut.Day(), 0, 0, 0, 0, d.WaktuUrut.Location())
+
+		const q4sel = `
+SELECT TOP 1 Tanggal, Keterangan
+FROM LOG_CASHDRAWER
+WHERE DATEDIFF(day, Tanggal, @date) = 0
+  AND CashIn = @bayar
+  AND LTRIM(RTRIM(Keterangan)) = @keteranganLama
+`
+		var tanggal time.Time
+		var exists string
+		if scanErr := tx.QueryRowContext(
+			ctx, q4sel,
+			sql.Named("date", dateOnly),
+			sql.Named("bayar", d.Bayar),
+			sql.Named("keteranganLama", keteranganLama),
+		).Scan(&tanggal, &exists); scanErr != nil {
+			if errors.Is(scanErr, sql.ErrNoRows) {
+				return types.ResponseSetOrderOnline{}, fmt.Errorf(
+					"log cashdrawer not found: date=%s bayar=%d keteranganLama=%s",
+					dateOnly.Format("2006-01-02"), d.Bayar, keteranganLama,
+				)
+			}
+			return types.ResponseSetOrderOnline{}, fmt.Errorf("query log cashdrawer failed: %w", scanErr)
+		}
+
+		q4upd := `
+WITH TargetRow AS (
+  SELECT TOP 1 *
+  FROM LOG_CASHDRAWER
+  WHERE ` + sameTime("Tanggal", "tanggal") + `
+    AND CashIn = @bayar
+    AND LTRIM(RTRIM(Keterangan)) = @keteranganLama
+)
+UPDATE TargetRow
+SET Keterangan = @keteranganBaru;
+`
+		res, err := tx.ExecContext(
+			ctx, q4upd,
+			sql.Named("tanggal", tanggal),
+			sql.Named("bayar", d.Bayar),
+			sql.Named("keteranganLama", keteranganLama),
+			sql.Named("keteranganBaru", keteranganBaru),
+		)
+		if err != nil {
+			return types.ResponseSetOrderOnline{}, fmt.Errorf("update LOG_CASHDRAWER failed: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n != 1 {
+			return types.ResponseSetOrderOnline{}, fmt.Errorf("update LOG_CASHDRAWER affected %d rows, expected 1", n)
+		}
+		logs = append(logs, keteranganBaru)
+		changes = append(changes, types.RowChange{
+			Table:  "LOG_CASHDRAWER",
+			Key:    map[string]any{"Tanggal": tanggal, "CashIn": d.Bayar},
+			Before: map[string]any{"Keterangan": exists},
+			After:  map[string]any{"Keterangan": keteranganBaru},
+		})
+	}
+
+	// (5) Reset status_kirim
+	const q5 = `
+UPDATE TR_SALES_HEADER
+SET status_kirim = '0'
+WHERE ID_TR_SALES_HEADER = @billcode
+`
+	if _, err = tx.ExecContext(ctx, q5, sql.Named("billcode", billcode)); err != nil {
+		return types.ResponseSetOrderOnline{}, fmt.Errorf("reset status_kirim failed: %w", err)
+	}
+	changes = append([]types.RowChange{
+		headerChange(b, map[string]any{"order_online": directSelling, "status_kirim": "0"}),
+	}, changes...)
+
+	// Audit trail (ikut transaksi; dry-run ikut ke-rollback)
+	if err = writeAudit(ctx, tx, m, changes); err != nil {
+		return types.ResponseSetOrderOnline{}, err
+	}
+
+	out := types.ResponseSetOrderOnline{
+		Billcode:      billcode,
+		OrderOnline:   directSelling,
+		LogCashdrawer: logs,
+		DryRun:        m.DryRun,
+		Changes:       changes,
+	}
+
+	// Commit (atau rollback kalau dry-run)
+	if err = finish(ctx, tx, m, out); err != nil {
+		return types.ResponseSetOrderOnline{}, fmt.Errorf("commit failed: %w", err)
+	}
+	return out, nil
+}
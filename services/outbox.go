@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"CommandHandler/types"
+)
+
+// outboxTable: status message final (COMPLETED/FAILED) ditulis di transaksi yang sama dengan
+// perubahan data, lalu dikirim oleh relay. Baris baru ditandai terkirim setelah broker ACK.
+const outboxTable = "CMD_STATUS_OUTBOX"
+
+const createOutboxTable = `
+IF OBJECT_ID(N'dbo.` + outboxTable + `', N'U') IS NULL
+CREATE TABLE dbo.` + outboxTable + ` (
+  ID         BIGINT IDENTITY(1,1) PRIMARY KEY,
+  TicketID   NVARCHAR(100) NOT NULL,
+  Status     NVARCHAR(20)  NOT NULL,
+  Body       NVARCHAR(MAX) NOT NULL,
+  CreatedAt  DATETIME2     NOT NULL,
+  SentAt     DATETIME2     NULL,
+  Attempts   INT           NOT NULL DEFAULT 0,
+  LastError  NVARCHAR(1000) NULL,
+  NextAttemptAt DATETIME2  NULL
+)
+IF COL_LENGTH(N'dbo.` + outboxTable + `', N'NextAttemptAt') IS NULL
+ALTER TABLE dbo.` + outboxTable + ` ADD NextAttemptAt DATETIME2 NULL
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = N'IX_` + outboxTable + `_Ticket')
+CREATE INDEX IX_` + outboxTable + `_Ticket ON dbo.` + outboxTable + ` (TicketID, ID)
+`
+
+// OutboxMessage: 1 status message yang belum terkirim.
+type OutboxMessage struct {
+	ID       int64
+	TicketID string
+	Status   string
+	Body     []byte
+	Attempts int
+}
+
+func insertOutbox(ctx context.Context, db execer, st types.TicketStatus) error {
+	if st.Timestamp.IsZero() {
+		st.Timestamp = time.Now()
+	}
+	body, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("marshal status: %w", err)
+	}
+	const q = `
+INSERT INTO dbo.` + outboxTable + ` (TicketID, Status, Body, CreatedAt)
+VALUES (@ticketId, @status, @body, SYSDATETIME())
+`
+	if _, err := db.ExecContext(
+		ctx, q,
+		sql.Named("ticketId", st.TicketID),
+		sql.Named("status", st.Status),
+		sql.Named("body", string(body)),
+	); err != nil {
+		return fmt.Errorf("write outbox: %w", err)
+	}
+	return nil
+}
+
+// PendingOutbox: status yang belum terkirim dan sudah waktunya dicoba, urut dari yang paling lama.
+// Per ticket hanya baris tertua yang belum terkirim (urutan status per ticket terjaga); baris yang
+// sedang backoff menahan ticket-nya sendiri saja, bukan ticket lain.
+func (s *Service) PendingOutbox(ctx context.Context, limit int) ([]OutboxMessage, error) {
+	const q = `
+SELECT TOP (@limit) o.ID, o.TicketID, o.Status, o.Body, o.Attempts
+FROM dbo.` + outboxTable + ` o
+WHERE o.SentAt IS NULL
+  AND (o.NextAttemptAt IS NULL OR o.NextAttemptAt <= SYSDATETIME())
+  AND NOT EXISTS (
+    SELECT 1 FROM dbo.` + outboxTable + ` p
+    WHERE p.TicketID = o.TicketID AND p.SentAt IS NULL AND p.ID < o.ID
+  )
+ORDER BY o.ID
+`
+	rows, err := s.DB.QueryContext(ctx, q, sql.Named("limit", limit))
+	if err != nil {
+		return nil, fmt.Errorf("query outbox failed: %w", err)
+	}
+	defer rows.Close()
+
+	var out []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		var body string
+		if err := rows.Scan(&m.ID, &m.TicketID, &m.Status, &body, &m.Attempts); err != nil {
+			return nil, fmt.Errorf("scan outbox failed: %w", err)
+		}
+		m.Body = []byte(body)
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// MarkOutboxSent: dipanggil hanya setelah broker ACK.
+func (s *Service) MarkOutboxSent(ctx context.Context, id int64) error {
+	const q = `UPDATE dbo.` + outboxTable + ` SET SentAt = SYSDATETIME(), LastError = NULL WHERE ID = @id`
+	_, err := s.DB.ExecContext(ctx, q, sql.Named("id", id))
+	return err
+}
+
+// MarkOutboxFailed: catat percobaan gagal. Baris tetap pending, dicoba lagi setelah backoff
+// (5s, 10s, 20s, ... maks 10 menit) supaya baris yang terus gagal tidak dicoba tiap putaran.
+func (s *Service) MarkOutboxFailed(ctx context.Context, id int64, cause error) error {
+	msg := cause.Error()
+	if len(msg) > 1000 {
+		msg = msg[:1000]
+	}
+	const q = `
+UPDATE dbo.` + outboxTable + `
+SET Attempts = Attempts + 1,
+    LastError = @err,
+    NextAttemptAt = DATEADD(second, CASE WHEN Attempts >= 7 THEN 600 ELSE 5 * POWER(2, Attempts) END, SYSDATETIME())
+WHERE ID = @id
+`
+	_, err := s.DB.ExecContext(ctx, q, sql.Named("id", id), sql.Named("err", msg))
+	return err
+}
+
+// PurgeOutbox: hapus baris yang sudah terkirim lebih lama dari retention (maks 1000 per panggilan).
+func (s *Service) PurgeOutbox(ctx context.Context, retention time.Duration) (int64, error) {
+	const q = `
+DELETE TOP (1000) FROM dbo.` + outboxTable + `
+WHERE SentAt IS NOT NULL AND SentAt < DATEADD(minute, -@minutes, SYSDATETIME())
+`
+	// int32: DATEADD menolak bigint (tipe default int di driver)
+	res, err := s.DB.ExecContext(ctx, q, sql.Named("minutes", int32(retention/time.Minute)))
+	if err != nil {
+		return 0, fmt.Errorf("purge outbox failed: %w", err)
+	}
+	return res.RowsAffected()
+}
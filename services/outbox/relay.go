@@ -0,0 +1,111 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	services "CommandHandler/services"
+	"CommandHandler/services/publisher"
+	"CommandHandler/utils"
+)
+
+// Relay mengirim status message dari tabel outbox ke RabbitMQ.
+// Baris ditandai terkirim hanya setelah broker ACK; kalau gagal, dicoba lagi setelah backoff.
+type Relay struct {
+	Log       *utils.Logger
+	Svc       *services.Service
+	Pub       *publisher.Publisher
+	Interval  time.Duration // polling; default 5s
+	Retention time.Duration // baris terkirim dihapus setelah ini; 0 = disimpan selamanya
+
+	kick      chan struct{}
+	mu        sync.Mutex // Run dan Flush tidak boleh mengirim bersamaan (baris yang sama terkirim 2x)
+	lastPurge time.Time
+}
+
+const purgeInterval = time.Hour
+
+func NewRelay(log *utils.Logger, svc *services.Service, pub *publisher.Publisher) *Relay {
+	return &Relay{Log: log, Svc: svc, Pub: pub, Interval: 5 * time.Second, kick: make(chan struct{}, 1)}
+}
+
+// Kick: minta relay jalan sekarang (tidak menunggu interval). Non-blocking.
+func (r *Relay) Kick() {
+	select {
+	case r.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Run: loop sampai ctx selesai.
+func (r *Relay) Run(ctx context.Context) {
+	t := time.NewTicker(r.Interval)
+	defer t.Stop()
+
+	for {
+		r.flush(ctx)
+		r.purge(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-r.kick:
+		}
+	}
+}
+
+// Flush: kirim semua yang pending sekali jalan (dipakai saat shutdown). Kalau Run sedang mengirim,
+// tunggu putaran itu selesai dulu.
+func (r *Relay) Flush(ctx context.Context) { r.flush(ctx) }
+
+func (r *Relay) flush(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	msgs, err := r.Svc.PendingOutbox(ctx, 50)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.Log.Warn("outbox read failed", "err", err)
+		}
+		return
+	}
+
+	for _, m := range msgs {
+		if !r.Pub.Ready() {
+			return
+		}
+		if err := r.Pub.PublishRaw(ctx, m.TicketID, m.Status, m.Body); err != nil {
+			if markErr := r.Svc.MarkOutboxFailed(ctx, m.ID, err); markErr != nil {
+				r.Log.Warn("outbox mark failed", "id", m.ID, "err", markErr)
+			}
+			// baris ini menunggu backoff (status berikutnya di ticket yang sama ikut menunggu);
+			// ticket lain tetap jalan
+			r.Log.Warn("outbox publish failed", "id", m.ID, "ticket", m.TicketID, "attempts", m.Attempts+1, "err", err)
+			continue
+		}
+		if err := r.Svc.MarkOutboxSent(ctx, m.ID); err != nil {
+			// status sudah terkirim tapi belum tertandai → bisa terkirim dua kali (at-least-once)
+			r.Log.Warn("outbox mark sent failed", "id", m.ID, "err", err)
+			return
+		}
+	}
+}
+
+// purge: hapus baris terkirim yang lebih tua dari Retention, paling sering sekali per purgeInterval.
+func (r *Relay) purge(ctx context.Context) {
+	if r.Retention <= 0 || time.Since(r.lastPurge) < purgeInterval {
+		return
+	}
+	r.lastPurge = time.Now()
+	n, err := r.Svc.PurgeOutbox(ctx, r.Retention)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.Log.Warn("outbox purge failed", "err", err)
+		}
+		return
+	}
+	if n > 0 {
+		r.Log.Info("outbox purged", "rows", n, "retention", r.Retention)
+	}
+}
@@ -0,0 +1,238 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"CommandHandler/types"
+	"CommandHandler/utils"
+)
+
+// Reason code penolakan (dikirim sebagai errorCode di status FAILED).
+const (
+	CodeNotAllowed      = "POLICY_NOT_ALLOWED"       // NIK/role tidak boleh menjalankan command ini
+	CodeGrandTotalLimit = "POLICY_GRAND_TOTAL_LIMIT" // grandTotal melebihi batas
+	CodePaymentPair     = "POLICY_PAYMENT_PAIR"      // pasangan from/to payment tidak diizinkan
+	CodeTooOld          = "POLICY_TRANSACTION_TOO_OLD"
+)
+
+// Denied: error penolakan policy, Code = salah satu Code* di atas.
+type Denied struct {
+	Code   string
+	Reason string
+}
+
+func (d *Denied) Error() string { return d.Reason }
+
+// Policy (file JSON), contoh:
+//
+//	{
+//	  "roles": {"support": ["1234567"], "supervisor": ["7654321"]},
+//	  "rules": [
+//	    {"commands": ["REPAIR_PAYMENT"], "roles": ["support"], "maxGrandTotal": 2000000,
+//	     "paymentPairs": [{"from": "CASH", "to": "*"}], "maxDaysBack": 3},
+//	    {"commands": ["*"], "roles": ["supervisor"]}
+//	  ]
+//	}
+type Policy struct {
+	Roles map[string][]string `json:"roles"`
+	Rules []Rule              `json:"rules"`
+}
+
+// Rule: siapa (niks/roles) boleh menjalankan command apa, dengan batas opsional (0/kosong = tanpa batas).
+type Rule struct {
+	Commands      []string      `json:"commands"` // "*" = semua
+	NIKs          []string      `json:"niks"`
+	Roles         []string      `json:"roles"`
+	MaxGrandTotal int           `json:"maxGrandTotal"`
+	PaymentPairs  []PaymentPair `json:"paymentPairs"` // key atau value ("DBCA" / "D.BCA"), "*" = apa saja
+	MaxDaysBack   int           `json:"maxDaysBack"`
+}
+
+type PaymentPair struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Request: fakta command yang dicek. GrandTotal < 0 / payment kosong = tidak relevan.
+type Request struct {
+	NIK         string
+	Command     types.CommandType
+	GrandTotal  int
+	FromPayment string
+	ToPayment   string
+	ToPayments  []string // SPLIT_PAYMENT: beberapa tujuan, dicek satu per satu
+}
+
+// Decision: batas yang masih harus dicek service (butuh data dari DB).
+type Decision struct {
+	MaxDaysBack int // 0 = tanpa batas
+}
+
+// Load membaca policy dari file JSON. path kosong → nil (semua NIK diizinkan).
+func Load(path string) (*Policy, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("parse policy %s: %w", path, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("policy %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+func (p *Policy) validate() error {
+	var errs []error
+	for i, r := range p.Rules {
+		if len(r.Commands) == 0 {
+			errs = append(errs, fmt.Errorf("rules[%d]: commands is empty", i))
+		}
+		if len(r.NIKs) == 0 && len(r.Roles) == 0 {
+			errs = append(errs, fmt.Errorf("rules[%d]: niks or roles required", i))
+		}
+		for _, role := range r.Roles {
+			if _, ok := p.Roles[role]; !ok {
+				errs = append(errs, fmt.Errorf("rules[%d]: unknown role %q", i, role))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Authorize: izinkan kalau ada minimal 1 rule yang cocok dan semua batasnya terpenuhi.
+// Kalau beberapa rule lolos, MaxDaysBack yang paling longgar yang dipakai.
+// Policy nil → semua diizinkan.
+func (p *Policy) Authorize(req Request) (Decision, error) {
+	if p == nil {
+		return Decision{}, nil
+	}
+
+	var denied *Denied
+	allowed := false
+	var dec Decision
+	for _, r := range p.Rules {
+		if !r.matchCommand(req.Command) || !p.matchSubject(r, req.NIK) {
+			continue
+		}
+		if d := r.check(req); d != nil {
+			if denied == nil {
+				denied = d
+			}
+			continue
+		}
+		if !allowed || r.MaxDaysBack == 0 || (dec.MaxDaysBack != 0 && r.MaxDaysBack > dec.MaxDaysBack) {
+			dec.MaxDaysBack = r.MaxDaysBack
+		}
+		allowed = true
+	}
+	if allowed {
+		return dec, nil
+	}
+	if denied != nil {
+		return Decision{}, denied
+	}
+	return Decision{}, &Denied{
+		Code:   CodeNotAllowed,
+		Reason: fmt.Sprintf("senderNik %s is not allowed to run %s", req.NIK, req.Command),
+	}
+}
+
+// CheckDaysBack: dipanggil service setelah tanggal transaksi diketahui.
+func (d Decision) CheckDaysBack(trxDate, now time.Time) error {
+	if d.MaxDaysBack <= 0 {
+		return nil
+	}
+	day := func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC) }
+	age := int(day(now).Sub(day(trxDate)).Hours() / 24)
+	if age > d.MaxDaysBack {
+		return &Denied{
+			Code:   CodeTooOld,
+			Reason: fmt.Sprintf("transaction date %s is %d days old, max %d", trxDate.Format("2006-01-02"), age, d.MaxDaysBack),
+		}
+	}
+	return nil
+}
+
+func (r Rule) matchCommand(t types.CommandType) bool {
+	for _, c := range r.Commands {
+		if c == "*" || strings.EqualFold(c, string(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) matchSubject(r Rule, nik string) bool {
+	for _, n := range r.NIKs {
+		if n == nik {
+			return true
+		}
+	}
+	for _, role := range r.Roles {
+		for _, n := range p.Roles[role] {
+			if n == nik {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r Rule) check(req Request) *Denied {
+	if r.MaxGrandTotal > 0 && req.GrandTotal > r.MaxGrandTotal {
+		return &Denied{
+			Code:   CodeGrandTotalLimit,
+			Reason: fmt.Sprintf("grandTotal %d exceeds limit %d", req.GrandTotal, r.MaxGrandTotal),
+		}
+	}
+	if len(r.PaymentPairs) > 0 && (req.FromPayment != "" || req.ToPayment != "" || len(req.ToPayments) > 0) {
+		tos := []string{req.ToPayment}
+		if len(req.ToPayments) > 0 {
+			tos = req.ToPayments
+		}
+		for _, to := range tos {
+			if !r.allowsPair(req.FromPayment, to) {
+				return &Denied{
+					Code:   CodePaymentPair,
+					Reason: fmt.Sprintf("payment change %s → %s is not allowed", req.FromPayment, to),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (r Rule) allowsPair(from, to string) bool {
+	for _, pp := range r.PaymentPairs {
+		if matchPayment(pp.From, from) && matchPayment(pp.To, to) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPayment(rule, got string) bool {
+	if rule == "*" {
+		return true
+	}
+	return strings.EqualFold(normalize(rule), normalize(got))
+}
+
+func normalize(s string) string {
+	if v, err := utils.GetPaymentValue(s); err == nil {
+		return v
+	}
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,184 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"CommandHandler/types"
+)
+
+func TestAuthorize(t *testing.T) {
+	p := &Policy{
+		Roles: map[string][]string{
+			"support":    {"111", "112"},
+			"supervisor": {"222"},
+		},
+		Rules: []Rule{
+			{Commands: []string{"REPAIR_PAYMENT"}, Roles: []string{"support"}, MaxGrandTotal: 1000,
+				PaymentPairs: []PaymentPair{{From: "CASH", To: "DBCA"}}, MaxDaysBack: 3},
+			{Commands: []string{"REPAIR_PAYMENT"}, NIKs: []string{"111"}, MaxDaysBack: 7},
+			{Commands: []string{"DELETE_PAYMENT"}, NIKs: []string{"333"},
+				PaymentPairs: []PaymentPair{{From: "CASH", To: "DBCA"}}},
+			{Commands: []string{"DELETE_PAYMENT"}, NIKs: []string{"444"},
+				PaymentPairs: []PaymentPair{{From: "CASH", To: "*"}}},
+			{Commands: []string{"REVERT_TICKET"}, NIKs: []string{"555"}, MaxDaysBack: 5},
+			{Commands: []string{"REVERT_TICKET"}, NIKs: []string{"555"}},
+			{Commands: []string{"REPAIR_PAYMENT"}, NIKs: []string{"666"}, MaxGrandTotal: 100, MaxDaysBack: 30},
+			{Commands: []string{"REPAIR_PAYMENT"}, NIKs: []string{"666"}, MaxDaysBack: 2},
+			{Commands: []string{"*"}, Roles: []string{"supervisor"}, MaxDaysBack: 30},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		req      Request
+		wantCode string // "" = diizinkan
+		wantDays int
+	}{
+		{
+			name:     "most permissive maxDaysBack wins across matching rules",
+			req:      Request{NIK: "111", Command: types.CommandRepairPayment, GrandTotal: 500, FromPayment: "CASH", ToPayment: "D.BCA"},
+			wantDays: 7,
+		},
+		{
+			name:     "unlimited rule (0) beats a limited one",
+			req:      Request{NIK: "555", Command: types.CommandRevertTicket, GrandTotal: -1},
+			wantDays: 0,
+		},
+		{
+			name:     "failing rule does not contribute its maxDaysBack",
+			req:      Request{NIK: "666", Command: types.CommandRepairPayment, GrandTotal: 500},
+			wantDays: 2,
+		},
+		{
+			name:     "wildcard command for role",
+			req:      Request{NIK: "222", Command: types.CommandRequeueDeadLetters, GrandTotal: -1},
+			wantDays: 30,
+		},
+		{
+			name:     "grandTotal over the limit of the only rule",
+			req:      Request{NIK: "112", Command: types.CommandRepairPayment, GrandTotal: 5000, FromPayment: "CASH", ToPayment: "DBCA"},
+			wantCode: CodeGrandTotalLimit,
+		},
+		{
+			name:     "payment pair not allowed",
+			req:      Request{NIK: "112", Command: types.CommandRepairPayment, GrandTotal: 500, FromPayment: "CASH", ToPayment: "KQRIS"},
+			wantCode: CodePaymentPair,
+		},
+		{
+			name:     "command not covered",
+			req:      Request{NIK: "111", Command: types.CommandDeletePayment, GrandTotal: -1},
+			wantCode: CodeNotAllowed,
+		},
+		{
+			name:     "unknown nik",
+			req:      Request{NIK: "999", Command: types.CommandRepairPayment, GrandTotal: 1},
+			wantCode: CodeNotAllowed,
+		},
+		{
+			name:     "delete payment: empty to is denied by a non-* pair",
+			req:      Request{NIK: "333", Command: types.CommandDeletePayment, GrandTotal: 100, FromPayment: "CASH"},
+			wantCode: CodePaymentPair,
+		},
+		{
+			name: "delete payment: empty to allowed by * pair",
+			req:  Request{NIK: "444", Command: types.CommandDeletePayment, GrandTotal: 100, FromPayment: "CASH"},
+		},
+		{
+			name:     "delete payment: from not in pair",
+			req:      Request{NIK: "444", Command: types.CommandDeletePayment, GrandTotal: 100, FromPayment: "DBCA"},
+			wantCode: CodePaymentPair,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec, err := p.Authorize(tt.req)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("Authorize = %v, want allowed", err)
+				}
+				if dec.MaxDaysBack != tt.wantDays {
+					t.Fatalf("MaxDaysBack = %d, want %d", dec.MaxDaysBack, tt.wantDays)
+				}
+				return
+			}
+			var denied *Denied
+			if !errors.As(err, &denied) {
+				t.Fatalf("Authorize = %v, want *Denied", err)
+			}
+			if denied.Code != tt.wantCode {
+				t.Fatalf("code = %s, want %s (%s)", denied.Code, tt.wantCode, denied.Reason)
+			}
+		})
+	}
+}
+
+func TestAuthorizeSplitChecksEveryTarget(t *testing.T) {
+	p := &Policy{Rules: []Rule{{
+		Commands:     []string{"SPLIT_PAYMENT"},
+		NIKs:         []string{"111"},
+		PaymentPairs: []PaymentPair{{From: "CASH", To: "DBCA"}, {From: "CASH", To: "Cash"}},
+	}}}
+	req := Request{NIK: "111", Command: types.CommandSplitPayment, FromPayment: "CASH", ToPayments: []string{"DBCA", "CASH"}}
+	if _, err := p.Authorize(req); err != nil {
+		t.Fatalf("Authorize = %v, want allowed", err)
+	}
+	req.ToPayments = append(req.ToPayments, "KQRIS")
+	var denied *Denied
+	if _, err := p.Authorize(req); !errors.As(err, &denied) || denied.Code != CodePaymentPair {
+		t.Fatalf("Authorize = %v, want %s", err, CodePaymentPair)
+	}
+}
+
+func TestAuthorizeNilPolicy(t *testing.T) {
+	var p *Policy
+	dec, err := p.Authorize(Request{NIK: "x", Command: types.CommandRevertTicket})
+	if err != nil || dec.MaxDaysBack != 0 {
+		t.Fatalf("Authorize = %+v, %v; want allowed without limit", dec, err)
+	}
+}
+
+func TestCheckDaysBack(t *testing.T) {
+	now := time.Date(2026, 10, 18, 1, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		max     int
+		trx     time.Time
+		wantErr bool
+	}{
+		{name: "no limit", max: 0, trx: now.AddDate(-1, 0, 0)},
+		{name: "same day", max: 1, trx: now},
+		{name: "on the limit", max: 3, trx: time.Date(2026, 10, 15, 23, 59, 0, 0, time.UTC)},
+		{name: "one day over", max: 3, trx: time.Date(2026, 10, 14, 23, 59, 0, 0, time.UTC), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Decision{MaxDaysBack: tt.max}.CheckDaysBack(tt.trx, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckDaysBack = %v, wantErr %v", err, tt.wantErr)
+			}
+			var denied *Denied
+			if err != nil && (!errors.As(err, &denied) || denied.Code != CodeTooOld) {
+				t.Fatalf("CheckDaysBack = %v, want %s", err, CodeTooOld)
+			}
+		})
+	}
+}
+
+func TestLoadExample(t *testing.T) {
+	p, err := Load("../../policy.example.json")
+	if err != nil {
+		t.Fatalf("Load example: %v", err)
+	}
+	if len(p.Rules) == 0 {
+		t.Fatal("example policy has no rules")
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	p := &Policy{Rules: []Rule{{Roles: []string{"ghost"}}}}
+	if err := p.validate(); err == nil {
+		t.Fatal("validate = nil, want errors for empty commands and unknown role")
+	}
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"CommandHandler/types"
+)
+
+// processedTable: ticket yang sudah selesai (COMPLETED/FAILED) + hasilnya, supaya redelivery
+// dari RabbitMQ tidak menjalankan command dua kali.
+const processedTable = "CMD_PROCESSED_TICKET"
+
+const createProcessedTable = `
+IF OBJECT_ID(N'dbo.` + processedTable + `', N'U') IS NULL
+CREATE TABLE dbo.` + processedTable + ` (
+  TicketID     NVARCHAR(100) NOT NULL PRIMARY KEY,
+  CommandType  NVARCHAR(50)  NOT NULL,
+  SenderNIK    NVARCHAR(50)  NOT NULL,
+  Status       NVARCHAR(20)  NOT NULL,
+  Result       NVARCHAR(MAX) NULL,
+  ProcessedAt  DATETIME2     NOT NULL
+)
+`
+
+// ProcessedTicket: hasil akhir ticket yang tersimpan.
+type ProcessedTicket struct {
+	TicketID    string
+	CommandType types.CommandType
+	SenderNIK   string
+	Status      string // COMPLETED / FAILED
+	Result      json.RawMessage
+}
+
+// LookupTicket: ok=false kalau ticket belum pernah selesai diproses.
+func (s *Service) LookupTicket(ctx context.Context, ticketID string) (ProcessedTicket, bool, error) {
+	ticketID = strings.TrimSpace(ticketID)
+	if ticketID == "" {
+		return ProcessedTicket{}, false, nil
+	}
+
+	const q = `
+SELECT TicketID, CommandType, SenderNIK, Status, Result
+FROM dbo.` + processedTable + `
+WHERE TicketID = @ticketId
+`
+	var t ProcessedTicket
+	var cmdType string
+	var result sql.NullString
+	err := s.DB.QueryRowContext(ctx, q, sql.Named("ticketId", ticketID)).
+		Scan(&t.TicketID, &cmdType, &t.SenderNIK, &t.Status, &result)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ProcessedTicket{}, false, nil
+		}
+		return ProcessedTicket{}, false, fmt.Errorf("query processed ticket failed: %w", err)
+	}
+	t.CommandType = types.CommandType(cmdType)
+	if result.Valid {
+		t.Result = json.RawMessage(result.String)
+	}
+	return t, true, nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertProcessed(ctx context.Context, db execer, m Meta, status string, result any) error {
+	b, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("marshal result: %w", err)
+	}
+	const q = `
+INSERT INTO dbo.` + processedTable + `
+  (TicketID, CommandType, SenderNIK, Status, Result, ProcessedAt)
+VALUES
+  (@ticketId, @commandType, @senderNik, @status, @result, SYSDATETIME())
+`
+	if _, err := db.ExecContext(
+		ctx, q,
+		sql.Named("ticketId", strings.TrimSpace(m.TicketID)),
+		sql.Named("commandType", string(m.CommandType)),
+		sql.Named("senderNik", m.SenderNIK),
+		sql.Named("status", status),
+		sql.Named("result", string(b)),
+	); err != nil {
+		return fmt.Errorf("record processed ticket: %w", err)
+	}
+	return nil
+}
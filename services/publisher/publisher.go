@@ -1,97 +1,271 @@
 package publisher
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
+	amqpc "CommandHandler/config/amqp"
+	"CommandHandler/services/monitor"
+	"CommandHandler/types"
 	"CommandHandler/utils"
 	"github.com/streadway/amqp"
 )
 
-const (
-	statusExchange   = "REPAIR_STATUS_TRANSACTION"
-	statusKind       = "direct"
-	statusRoutingKey = "REPAIR.STATUS.UPDATED" // pastikan SAMA dgn binding di RabbitMQ
+const confirmTimeout = 5 * time.Second
+
+var (
+	errNotOpen = errors.New("publisher channel not open")
+	errNacked  = errors.New("publish nacked")
 )
 
-type TicketStatus struct {
-	TicketID  string `json:"ticketId"`
-	SenderNIK string `json:"senderNik"`
-	Status    string `json:"status"`
+// Publisher: channel AMQP khusus publish status (terpisah dari channel consumer), confirm mode.
+// Exchange di-declare sekali per channel; confirm & return dicocokkan lewat delivery tag / MessageId,
+// jadi aman dipakai banyak goroutine sekaligus.
+type Publisher struct {
+	log *utils.Logger
+
+	Metrics *monitor.Metrics // opsional, hasil confirm dicatat di sini
+
+	// Topology: status exchange + routing key (set sebelum Open; default DefaultTopology)
+	Topology amqpc.Topology
+
+	mu      sync.Mutex
+	ch      *amqp.Channel
+	gen     uint64 // naik tiap Open, bagian dari MessageId
+	seq     uint64 // delivery tag terakhir di channel ini
+	pending map[uint64]*inflight
+	byMsgID map[string]*inflight
 }
 
-func PublishTicketStatus(log *utils.Logger, ch *amqp.Channel, ticketID, senderNIK, status string) error {
-	if status != "COMPLETED" && status != "FAILED" {
-		log.Fail("invalid status", "status", status)
-		return fmt.Errorf("invalid status: %s", status)
-	}
+type inflight struct {
+	msgID    string
+	returned string // reply text kalau pesan dikembalikan broker (unroutable)
+	done     chan error
+}
 
-	// pastikan exchange ada
-	if err := ch.ExchangeDeclare(statusExchange, statusKind, true, false, false, false, nil); err != nil {
-		log.Fail("exchange declare failed", "err", err)
+func New(log *utils.Logger) *Publisher {
+	return &Publisher{log: log, Topology: amqpc.DefaultTopology()}
+}
+
+// Open membuka channel baru di conn (dipanggil tiap connect/reconnect), declare topology,
+// dan aktifkan confirm mode. Channel lama (kalau ada) diganti.
+func (p *Publisher) Open(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
 		return err
 	}
-
+	if err := ch.ExchangeDeclare(p.Topology.StatusExchangeName(), p.Topology.StatusExchangeKind, true, false, false, false, nil); err != nil {
+		_ = ch.Close()
+		return fmt.Errorf("status exchange declare failed: %w", err)
+	}
 	if err := ch.Confirm(false); err != nil {
-		log.Warn("publisher confirms not supported", "err", err)
+		_ = ch.Close()
+		return fmt.Errorf("publisher confirms not supported: %w", err)
+	}
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 64))
+	returns := ch.NotifyReturn(make(chan amqp.Return, 64))
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	p.mu.Lock()
+	old := p.ch
+	p.failAll(errNotOpen)
+	p.ch = ch
+	p.gen++
+	p.seq = 0
+	p.pending = map[uint64]*inflight{}
+	p.byMsgID = map[string]*inflight{}
+	p.mu.Unlock()
+
+	if old != nil {
+		_ = old.Close()
 	}
-	acks := ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	go p.loop(ch, confirms, returns, closed)
+	return nil
+}
 
-	// detect NO_ROUTE
-	returns := ch.NotifyReturn(make(chan amqp.Return, 1))
+// Close menutup channel publisher.
+func (p *Publisher) Close() {
+	p.mu.Lock()
+	ch := p.ch
+	p.ch = nil
+	p.failAll(errNotOpen)
+	p.mu.Unlock()
+	if ch != nil {
+		_ = ch.Close()
+	}
+}
 
-	body, _ := json.Marshal(TicketStatus{TicketID: ticketID, SenderNIK: senderNIK, Status: status})
+// Ready: channel publisher terbuka.
+func (p *Publisher) Ready() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ch != nil
+}
+
+// loop: cocokkan confirm (by delivery tag) dan return (by MessageId) ke publish yang menunggu.
+// RabbitMQ selalu mengirim basic.return sebelum basic.ack untuk pesan yang sama.
+func (p *Publisher) loop(ch *amqp.Channel, confirms <-chan amqp.Confirmation, returns <-chan amqp.Return, closed <-chan *amqp.Error) {
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			p.mu.Lock()
+			if p.ch == ch {
+				if f := p.byMsgID[r.MessageId]; f != nil {
+					f.returned = r.ReplyText
+				}
+			}
+			p.mu.Unlock()
+
+		case c, ok := <-confirms:
+			if !ok {
+				confirms = nil
+				continue
+			}
+			// channel sudah diganti → tag milik channel lama, abaikan
+			var f *inflight
+			p.mu.Lock()
+			if p.ch == ch {
+				if f = p.pending[c.DeliveryTag]; f != nil {
+					delete(p.pending, c.DeliveryTag)
+					delete(p.byMsgID, f.msgID)
+				}
+			}
+			p.mu.Unlock()
+			if f == nil {
+				continue
+			}
+			switch {
+			case f.returned != "":
+				f.done <- fmt.Errorf("unroutable: %s", f.returned)
+			case !c.Ack:
+				f.done <- errNacked
+			default:
+				f.done <- nil
+			}
+
+		case err := <-closed:
+			p.mu.Lock()
+			if p.ch == ch {
+				p.ch = nil
+				p.failAll(fmt.Errorf("publisher channel closed: %v", err))
+			}
+			p.mu.Unlock()
+			return
+		}
+	}
+}
+
+// failAll: gagalkan semua publish yang masih menunggu confirm. Caller pegang p.mu.
+func (p *Publisher) failAll(err error) {
+	for tag, f := range p.pending {
+		f.done <- err
+		delete(p.pending, tag)
+	}
+	p.byMsgID = map[string]*inflight{}
+}
+
+// publish body ke status exchange (mandatory=true) dan tunggu confirm.
+func (p *Publisher) publish(ctx context.Context, body []byte) error {
+	p.mu.Lock()
+	if p.ch == nil {
+		p.mu.Unlock()
+		return errNotOpen
+	}
+	p.seq++
+	tag := p.seq
+	f := &inflight{
+		msgID: strconv.FormatUint(p.gen, 10) + "-" + strconv.FormatUint(tag, 10),
+		done:  make(chan error, 1),
+	}
+	p.pending[tag] = f
+	p.byMsgID[f.msgID] = f
 
 	// publish dengan mandatory=true agar unroutable masuk ke NotifyReturn
-	if err := ch.Publish(
-		statusExchange,
-		statusRoutingKey,
+	err := p.ch.Publish(
+		p.Topology.StatusExchangeName(),
+		p.Topology.StatusRoutingKey,
 		true,
 		false,
 		amqp.Publishing{
 			ContentType:  "application/json",
+			MessageId:    f.msgID,
 			Body:         body,
 			DeliveryMode: amqp.Persistent,
 		},
-	); err != nil {
-		log.Fail("💥 status publish failed", "ticket", ticketID, "err", err)
+	)
+	if err != nil {
+		delete(p.pending, tag)
+		delete(p.byMsgID, f.msgID)
+	}
+	p.mu.Unlock()
+	if err != nil {
+		p.Metrics.PublishConfirm("error")
 		return err
 	}
 
-	timer := time.NewTimer(2 * time.Second)
+	timer := time.NewTimer(confirmTimeout)
 	defer timer.Stop()
 
 	select {
-	case r := <-returns:
-
-		log.Fail("⛔ UNROUTABLE",
-			"ticket", ticketID,
-			"rk", r.RoutingKey,
-			"reason", r.ReplyText,
-		)
-		return fmt.Errorf("unroutable: %s", r.ReplyText)
-
-	case c := <-acks:
-		if c.Ack {
-			log.OK("✅ status published",
-				"exchange", statusExchange,
-				"rk", statusRoutingKey,
-				"ticket", ticketID,
-				"status", status,
-			)
-			return nil
+	case err := <-f.done:
+		switch {
+		case err == nil:
+			p.Metrics.PublishConfirm("ack")
+		case f.returned != "":
+			p.Metrics.PublishConfirm("returned")
+		case errors.Is(err, errNacked):
+			p.Metrics.PublishConfirm("nack")
+		default:
+			p.Metrics.PublishConfirm("error")
 		}
-		log.Fail("💥 publish NACKed", "ticket", ticketID)
-		return fmt.Errorf("publish nacked")
-
+		return err
 	case <-timer.C:
-		log.Warn("publish confirm timeout (assume routed)",
-			"exchange", statusExchange,
-			"rk", statusRoutingKey,
+		p.Metrics.PublishConfirm("timeout")
+		return errors.New("publish confirm timeout")
+	case <-ctx.Done():
+		p.Metrics.PublishConfirm("error")
+		return ctx.Err()
+	}
+}
+
+// PublishStatus publish 1 status ticket ke status exchange. Timestamp diisi otomatis kalau kosong.
+// Best-effort: error di-log dan dikembalikan; untuk pengiriman terjamin pakai outbox.
+func (p *Publisher) PublishStatus(ctx context.Context, st types.TicketStatus) error {
+	if !types.ValidTicketStatus(st.Status) {
+		p.log.Fail("invalid status", "status", st.Status)
+		return fmt.Errorf("invalid status: %s", st.Status)
+	}
+	if st.Timestamp.IsZero() {
+		st.Timestamp = time.Now()
+	}
+	body, _ := json.Marshal(st)
+	return p.PublishRaw(ctx, st.TicketID, st.Status, body)
+}
+
+// PublishRaw publish body status yang sudah jadi (mis. dari outbox). nil hanya kalau broker ACK.
+func (p *Publisher) PublishRaw(ctx context.Context, ticketID, status string, body []byte) error {
+	if err := p.publish(ctx, body); err != nil {
+		p.log.Fail("status publish failed",
 			"ticket", ticketID,
 			"status", status,
+			"err", err,
 		)
-		return nil
+		return err
 	}
+	p.log.OK("status published",
+		"exchange", p.Topology.StatusExchangeName(),
+		"rk", p.Topology.StatusRoutingKey,
+		"ticket", ticketID,
+		"status", status,
+	)
+	return nil
 }
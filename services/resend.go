@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"CommandHandler/types"
+)
+
+const (
+	defaultResendRows = 200
+	maxResendRows     = 1000 // batas keras (SQL Server maks 2100 parameter per query)
+)
+
+// ResendTransaction: reset TR_SALES_HEADER.status_kirim = '0' supaya bill dikirim ulang ke HO.
+// Target: 1 billcode, beberapa billcode, atau rentang tanggal (WAKTU_URUT payment detail).
+// Kalau header yang cocok melebihi maxRows, command ditolak (tidak ada yang diubah).
+func (s *Service) ResendTransaction(ctx context.Context, m Meta, p types.PayloadResendTransaction) (types.ResponseResendTransaction, error) {
+	limit := p.MaxRows
+	if limit <= 0 {
+		limit = defaultResendRows
+	}
+	if limit > maxResendRows {
+		return types.ResponseResendTransaction{}, fmt.Errorf("maxRows must be <= %d", maxResendRows)
+	}
+
+	where, args, wanted, from, err := resendFilter(p)
+	if err != nil {
+		return types.ResponseResendTransaction{}, err
+	}
+	if !from.IsZero() {
+		// policy: batas umur transaksi yang boleh diubah
+		if err := m.Policy.CheckDaysBack(from, time.Now()); err != nil {
+			return types.ResponseResendTransaction{}, err
+		}
+	}
+
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return types.ResponseResendTransaction{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }() // aman walau sudah commit
+
+	// (1) Header yang cocok (dikunci sampai commit), ambil limit+1 untuk deteksi kelebihan.
+	// Tanggal transaksi = WAKTU_URUT payment pertama, untuk cek policy per bill.
+	q1 := `
+SELECT TOP (@limit) ID_TR_SALES_HEADER, status_kirim, d.WAKTU_URUT
+FROM TR_SALES_HEADER WITH (UPDLOCK)
+OUTER APPLY (
+  SELECT MIN(p.WAKTU_URUT) AS WAKTU_URUT
+  FROM TR_SALES_PAYMENT_DETAIL p
+  WHERE p.ID_TR_SALES_HEADER = TR_SALES_HEADER.ID_TR_SALES_HEADER
+) d
+WHERE ` + where + `
+ORDER BY ID_TR_SALES_HEADER
+`
+	rows, err := tx.QueryContext(ctx, q1, append(args, sql.Named("limit", limit+1))...)
+	if err != nil {
+		return types.ResponseResendTransaction{}, fmt.Errorf("query header failed: %w", err)
+	}
+	var found []bill
+	dates := map[string]sql.NullTime{}
+	for rows.Next() {
+		var b bill
+		var waktu sql.NullTime
+		if err := rows.Scan(&b.ID, &b.StatusKirim, &waktu); err != nil {
+			rows.Close()
+			return types.ResponseResendTransaction{}, fmt.Errorf("scan header failed: %w", err)
+		}
+		found = append(found, b)
+		dates[b.ID] = waktu
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return types.ResponseResendTransaction{}, fmt.Errorf("query header failed: %w", err)
+	}
+	if len(found) == 0 {
+		return types.ResponseResendTransaction{}, fmt.Errorf("no transaction found")
+	}
+	if len(found) > limit {
+		return types.ResponseResendTransaction{}, fmt.Errorf("more than %d headers match, narrow the filter or raise maxRows", limit)
+	}
+
+	out := types.ResponseResendTransaction{DryRun: m.DryRun, Billcodes: []string{}}
+	var changes []types.RowChange
+	seen := map[string]bool{}
+	for _, b := range found {
+		seen[strings.TrimSpace(b.ID)] = true
+		if b.StatusKirim.Valid && strings.TrimSpace(b.StatusKirim.String) == "0" {
+			out.AlreadyPending = append(out.AlreadyPending, b.ID)
+			continue
+		}
+		// policy per bill: mode billcode bisa menunjuk bill umur berapa saja
+		if m.Policy.MaxDaysBack > 0 {
+			waktu := dates[b.ID]
+			if !waktu.Valid {
+				return types.ResponseResendTransaction{}, fmt.Errorf("transaction date of %s unknown (no payment detail), cannot check maxDaysBack", b.ID)
+			}
+			if err := m.Policy.CheckDaysBack(waktu.Time, time.Now()); err != nil {
+				return types.ResponseResendTransaction{}, err
+			}
+		}
+		out.Billcodes = append(out.Billcodes, b.ID)
+		changes = append(changes, headerChange(b, map[string]any{"status_kirim": "0"}))
+	}
+	for _, id := range wanted {
+		if !seen[id] {
+			out.NotFound = append(out.NotFound, id)
+		}
+	}
+	out.Count = len(out.Billcodes)
+
+	// (2) Reset status_kirim (yang sudah '0' tidak disentuh)
+	if out.Count > 0 {
+		q2 := `
+UPDATE TR_SALES_HEADER
+SET status_kirim = '0'
+WHERE ` + where + `
+  AND ISNULL(LTRIM(RTRIM(status_kirim)), '') <> '0'
+`
+		res, err := tx.ExecContext(ctx, q2, args...)
+		if err != nil {
+			return types.ResponseResendTransaction{}, fmt.Errorf("reset status_kirim failed: %w", err)
+		}
+		if n, _ := res.RowsAffected(); int(n) != out.Count {
+			return types.ResponseResendTransaction{}, fmt.Errorf("reset status_kirim affected %d rows, expected %d", n, out.Count)
+		}
+	}
+
+	// Audit trail (ikut transaksi; dry-run ikut ke-rollback)
+	if err = writeAudit(ctx, tx, m, changes); err != nil {
+		return types.ResponseResendTransaction{}, err
+	}
+
+	// Commit (atau rollback kalau dry-run)
+	if err = finish(ctx, tx, m, out); err != nil {
+		return types.ResponseResendTransaction{}, fmt.Errorf("commit failed: %w", err)
+	}
+	return out, nil
+}
+
+// resendFilter: klausa WHERE untuk TR_SALES_HEADER + parameternya. wanted = billcode yang diminta
+// (kosong untuk mode tanggal), untuk laporan notFound. from = awal rentang (nol untuk mode billcode).
+func resendFilter(p types.PayloadResendTransaction) (where string, args []any, wanted []string, from time.Time, err error) {
+	ids := p.Billcodes
+	if id := strings.TrimSpace(p.IDTRSalesHeader); id != "" {
+		ids = append([]string{id}, ids...)
+	}
+	dated := strings.TrimSpace(p.DateFrom) != "" || strings.TrimSpace(p.DateTo) != ""
+
+	switch {
+	case len(ids) > 0 && dated:
+		return "", nil, nil, from, fmt.Errorf("use either billcodes or dateFrom/dateTo, not both")
+
+	case len(ids) > 0:
+		if len(ids) > maxResendRows {
+			return "", nil, nil, from, fmt.Errorf("too many billcodes (max %d)", maxResendRows)
+		}
+		seen := map[string]bool{}
+		var names []string
+		for _, id := range ids {
+			id = strings.TrimSpace(id)
+			if id == "" || seen[id] {
+				continue
+			}
+			seen[id] = true
+			name := "b" + strconv.Itoa(len(names))
+			names = append(names, "@"+name)
+			args = append(args, sql.Named(name, id))
+			wanted = append(wanted, id)
+		}
+		if len(names) == 0 {
+			return "", nil, nil, from, fmt.Errorf("billcodes are empty")
+		}
+		return "ID_TR_SALES_HEADER IN (" + strings.Join(names, ", ") + ")", args, wanted, from, nil
+
+	case dated:
+		var to time.Time
+		if from, err = time.Parse("2006-01-02", strings.TrimSpace(p.DateFrom)); err != nil {
+			return "", nil, nil, from, fmt.Errorf("dateFrom must be YYYY-MM-DD")
+		}
+		to = from
+		if strings.TrimSpace(p.DateTo) != "" {
+			if to, err = time.Parse("2006-01-02", strings.TrimSpace(p.DateTo)); err != nil {
+				return "", nil, nil, from, fmt.Errorf("dateTo must be YYYY-MM-DD")
+			}
+		}
+		if to.Before(from) {
+			return "", nil, nil, from, fmt.Errorf("dateTo is before dateFrom")
+		}
+		to = to.AddDate(0, 0, 1) // inklusif → batas atas eksklusif
+		const q = `ID_TR_SALES_HEADER IN (
+  SELECT ID_TR_SALES_HEADER
+  FROM TR_SALES_PAYMENT_DETAIL
+  WHERE WAKTU_URUT >= @dateFrom AND WAKTU_URUT < @dateTo
+)`
+		return q, []any{sql.Named("dateFrom", from), sql.Named("dateTo", to)}, nil, from, nil
+	}
+	return "", nil, nil, from, fmt.Errorf("ID_TR_SALES_HEADER, billcodes or dateFrom is required")
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"CommandHandler/types"
+)
+
+// revertable: tabel yang boleh di-revert, beserta kolom key dan kolom nilai yang boleh di-restore.
+// Nama kolom dari tabel audit hanya dipakai kalau ada di whitelist ini (aman dari SQL injection).
+var revertable = map[string]struct {
+	keys []string
+	cols []string
+}{
+	"TR_SALES_HEADER":         {keys: []string{"ID_TR_SALES_HEADER"}, cols: []string{"order_online", "status_kirim"}},
+	"TR_SALES_PAYMENT_DETAIL": {keys: []string{"ID_TR_SALES_HEADER", "WAKTU_URUT"}, cols: []string{"TIPE_BAYAR"}},
+	"LOG_CASHDRAWER":          {keys: []string{"Tanggal", "CashIn"}, cols: []string{"Keterangan"}},
+}
+
+// kolom bertipe datetime di key (disimpan sebagai string RFC3339 di audit)
+var timeKeys = map[string]bool{"WAKTU_URUT": true, "Tanggal": true}
+
+type auditRow struct {
+	ID     int64
+	Table  string
+	RowKey string
+	Before map[string]any
+	After  map[string]any
+}
+
+// RevertTicket mengembalikan nilai sebelum ticket target dijalankan, berdasarkan tabel audit.
+// Ditolak kalau baris sudah diubah lagi setelah ticket tsb, atau ticket menghapus baris.
+func (s *Service) RevertTicket(ctx context.Context, m Meta, p types.PayloadRevertTicket) (types.ResponseRevertTicket, error) {
+	target := strings.TrimSpace(p.TargetTicketID)
+	if target == "" {
+		return types.ResponseRevertTicket{}, fmt.Errorf("missing targetTicketId")
+	}
+	if target == m.TicketID {
+		return types.ResponseRevertTicket{}, fmt.Errorf("ticket cannot revert itself")
+	}
+
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return types.ResponseRevertTicket{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }() // aman walau sudah commit
+
+	// (1) Ambil snapshot ticket target
+	rows, err := loadAudit(ctx, tx, target)
+	if err != nil {
+		return types.ResponseRevertTicket{}, err
+	}
+	if len(rows) == 0 {
+		return types.ResponseRevertTicket{}, fmt.Errorf("no audit trail for ticket %s", target)
+	}
+
+	// policy: batas umur transaksi berlaku juga untuk revert
+	if m.Policy.MaxDaysBack > 0 {
+		for _, r := range rows {
+			t, err := auditRowDate(ctx, tx, r)
+			if err != nil {
+				return types.ResponseRevertTicket{}, err
+			}
+			if err := m.Policy.CheckDaysBack(t, time.Now()); err != nil {
+				return types.ResponseRevertTicket{}, err
+			}
+		}
+	}
+
+	// (2) Tolak kalau ada ticket lain yang menyentuh baris yang sama setelahnya
+	for _, r := range rows {
+		var later string
+		const q = `
+SELECT TOP 1 TicketID
+FROM dbo.` + auditTable + `
+WHERE ID > @id
+  AND TicketID <> @ticketId
+  AND TableName = @tableName
+  AND RowKey = @rowKey
+`
+		err := tx.QueryRowContext(
+			ctx, q,
+			sql.Named("id", r.ID),
+			sql.Named("ticketId", target),
+			sql.Named("tableName", r.Table),
+			sql.Named("rowKey", r.RowKey),
+		).Scan(&later)
+		if err == nil {
+			return types.ResponseRevertTicket{}, fmt.Errorf("%s %s was modified afterwards by ticket %s", r.Table, r.RowKey, later)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return types.ResponseRevertTicket{}, fmt.Errorf("query audit failed: %w", err)
+		}
+	}
+
+	// (3) Restore, urutan terbalik
+	var changes []types.RowChange
+	for i := len(rows) - 1; i >= 0; i-- {
+		c, err := revertRow(ctx, tx, rows[i])
+		if err != nil {
+			return types.ResponseRevertTicket{}, err
+		}
+		changes = append(changes, c)
+	}
+
+	// Audit trail revert itu sendiri
+	if err = writeAudit(ctx, tx, m, changes); err != nil {
+		return types.ResponseRevertTicket{}, err
+	}
+
+	res := types.ResponseRevertTicket{
+		TargetTicketID: target,
+		DryRun:         m.DryRun,
+		Changes:        changes,
+	}
+
+	// Commit (atau rollback kalau dry-run)
+	if err = finish(ctx, tx, m, res); err != nil {
+		return types.ResponseRevertTicket{}, fmt.Errorf("commit failed: %w", err)
+	}
+	return res, nil
+}
+
+func loadAudit(ctx context.Context, tx *sql.Tx, ticketID string) ([]auditRow, error) {
+	const q = `
+SELECT ID, TableName, RowKey, BeforeValues, AfterValues
+FROM dbo.` + auditTable + ` WITH (UPDLOCK, HOLDLOCK)
+WHERE TicketID = @ticketId
+ORDER BY ID
+`
+	rs, err := tx.QueryContext(ctx, q, sql.Named("ticketId", ticketID))
+	if err != nil {
+		return nil, fmt.Errorf("query audit failed: %w", err)
+	}
+	defer rs.Close()
+
+	var out []auditRow
+	for rs.Next() {
+		var r auditRow
+		var before, after sql.NullString
+		if err := rs.Scan(&r.ID, &r.Table, &r.RowKey, &before, &after); err != nil {
+			return nil, fmt.Errorf("scan audit failed: %w", err)
+		}
+		if before.Valid {
+			_ = json.Unmarshal([]byte(before.String), &r.Before)
+		}
+		if after.Valid {
+			_ = json.Unmarshal([]byte(after.String), &r.After)
+		}
+		out = append(out, r)
+	}
+	return out, rs.Err()
+}
+
+// revertRow: UPDATE baris ke nilai Before, hanya kalau nilai sekarang masih sama dengan After.
+// status_kirim tidak dicek (bisa sudah di-set '1' oleh proses sync) dan selalu di-reset ke '0'.
+func revertRow(ctx context.Context, tx *sql.Tx, r auditRow) (types.RowChange, error) {
+	spec, ok := revertable[r.Table]
+	if !ok {
+		return types.RowChange{}, fmt.Errorf("table %s cannot be reverted", r.Table)
+	}
+	if r.After == nil {
+		return types.RowChange{}, fmt.Errorf("%s %s was deleted by the ticket, cannot be reverted", r.Table, r.RowKey)
+	}
+	if r.Before == nil {
+		return types.RowChange{}, fmt.Errorf("%s %s was inserted by the ticket, cannot be reverted", r.Table, r.RowKey)
+	}
+	// kolom di luar whitelist (mis. BAYAR/CashIn dari SPLIT_PAYMENT) → revert parsial, tolak
+	for col := range r.After {
+		if !slices.Contains(spec.cols, col) {
+			return types.RowChange{}, fmt.Errorf("%s %s changed column %s, cannot be reverted", r.Table, r.RowKey, col)
+		}
+	}
+
+	var key map[string]any
+	if err := json.Unmarshal([]byte(r.RowKey), &key); err != nil {
+		return types.RowChange{}, fmt.Errorf("invalid audit key %s: %w", r.RowKey, err)
+	}
+
+	var where, set []string
+	var args []any
+	for _, k := range spec.keys {
+		v, ok := key[k]
+		if !ok {
+			return types.RowChange{}, fmt.Errorf("audit key %s missing %s", r.RowKey, k)
+		}
+		if s, isStr := v.(string); isStr && timeKeys[k] {
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return types.RowChange{}, fmt.Errorf("audit key %s: %w", k, err)
+			}
+			v = t
+		}
+		if timeKeys[k] {
+			where = append(where, sameTime(k, "k_"+k))
+		} else {
+			where = append(where, fmt.Sprintf("%s = @k_%s", k, k))
+		}
+		args = append(args, sql.Named("k_"+k, v))
+	}
+
+	before := map[string]any{}
+	after := map[string]any{}
+	for _, col := range spec.cols {
+		old, ok := r.Before[col]
+		if !ok {
+			continue
+		}
+		if col == "status_kirim" {
+			set = append(set, "status_kirim = '0'")
+			before[col] = r.After[col]
+			after[col] = "0"
+			continue
+		}
+		where = append(where, fmt.Sprintf("LTRIM(RTRIM(%s)) = LTRIM(RTRIM(@a_%s))", col, col))
+		set = append(set, fmt.Sprintf("%s = @b_%s", col, col))
+		args = append(args, sql.Named("a_"+col, r.After[col]), sql.Named("b_"+col, old))
+		before[col] = r.After[col]
+		after[col] = old
+	}
+	if len(set) == 0 {
+		return types.RowChange{}, fmt.Errorf("%s %s has nothing to revert", r.Table, r.RowKey)
+	}
+
+	// key LOG_CASHDRAWER (Tanggal, CashIn) tidak unik: kalau lebih dari 1 baris cocok, TOP 1 bisa
+	// mengenai baris bill lain → tolak
+	var n int
+	qc := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", r.Table, strings.Join(where, " AND "))
+	if err := tx.QueryRowContext(ctx, qc, args...).Scan(&n); err != nil {
+		return types.RowChange{}, fmt.Errorf("query %s failed: %w", r.Table, err)
+	}
+	if n > 1 {
+		return types.RowChange{}, fmt.Errorf("%s %s matches %d rows, cannot tell which one to revert", r.Table, r.RowKey, n)
+	}
+
+	q := fmt.Sprintf(`
+WITH TargetRow AS (
+  SELECT TOP 1 *
+  FROM %s
+  WHERE %s
+)
+UPDATE TargetRow
+SET %s;
+`, r.Table, strings.Join(where, "\n    AND "), strings.Join(set, ", "))
+
+	res, err := tx.ExecContext(ctx, q, args...)
+	if err != nil {
+		return types.RowChange{}, fmt.Errorf("revert %s failed: %w", r.Table, err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return types.RowChange{}, fmt.Errorf("%s %s was modified afterwards, refusing to revert", r.Table, r.RowKey)
+	}
+
+	return types.RowChange{Table: r.Table, Key: key, Before: before, After: after}, nil
+}
+
+// auditRowDate: tanggal transaksi baris audit (untuk maxDaysBack). Baris payment/cashdrawer punya
+// tanggal di key; header pakai WAKTU_URUT payment pertama bill-nya.
+func auditRowDate(ctx context.Context, tx *sql.Tx, r auditRow) (time.Time, error) {
+	var key map[string]any
+	if err := json.Unmarshal([]byte(r.RowKey), &key); err != nil {
+		return time.Time{}, fmt.Errorf("invalid audit key %s: %w", r.RowKey, err)
+	}
+	for k := range timeKeys {
+		if s, ok := key[k].(string); ok {
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("audit key %s: %w", k, err)
+			}
+			return t, nil
+		}
+	}
+
+	id, _ := key["ID_TR_SALES_HEADER"].(string)
+	const q = `
+SELECT MIN(WAKTU_URUT)
+FROM TR_SALES_PAYMENT_DETAIL
+WHERE ID_TR_SALES_HEADER = @billcode
+`
+	var t sql.NullTime
+	if err := tx.QueryRowContext(ctx, q, sql.Named("billcode", id)).Scan(&t); err != nil {
+		return time.Time{}, fmt.Errorf("query payment detail failed: %w", err)
+	}
+	if !t.Valid {
+		return time.Time{}, fmt.Errorf("transaction date of %s %s unknown, cannot check maxDaysBack", r.Table, r.RowKey)
+	}
+	return t.Time, nil
+}
@@ -0,0 +1,106 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/streadway/amqp"
+)
+
+// Header AMQP untuk signature command.
+const (
+	HeaderSignature = "x-signature" // hex(HMAC-SHA256(secret, body))
+	HeaderKeyID     = "x-key-id"    // id key yang dipakai (opsional; kosong → coba semua key aktif)
+)
+
+var (
+	ErrUnsigned     = errors.New("message is not signed")
+	ErrUnknownKey   = errors.New("unknown signing key")
+	ErrBadSignature = errors.New("invalid signature")
+)
+
+// Keyring: key HMAC aktif. Beberapa key boleh aktif bersamaan untuk rotasi
+// (publisher pindah ke key baru, key lama dihapus setelah semua pesan lama habis).
+type Keyring struct {
+	keys map[string][]byte
+}
+
+// ParseKeys: format "id1:secret1,id2:secret2". String kosong → nil (verifikasi tidak aktif).
+func ParseKeys(s string) (*Keyring, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	k := &Keyring{keys: map[string][]byte{}}
+	for _, part := range strings.Split(s, ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(part), ":")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("invalid signing key entry %q (want id:secret)", part)
+		}
+		if _, dup := k.keys[id]; dup {
+			return nil, fmt.Errorf("duplicate signing key id %q", id)
+		}
+		k.keys[id] = []byte(secret)
+	}
+	return k, nil
+}
+
+// KeyIDs: daftar id key aktif (untuk log startup, tanpa secret).
+func (k *Keyring) KeyIDs() []string {
+	out := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		out = append(out, id)
+	}
+	return out
+}
+
+// Sign: signature hex untuk body (dipakai publisher / tooling).
+func (k *Keyring) Sign(keyID string, body []byte) (string, error) {
+	secret, ok := k.keys[keyID]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+	return hex.EncodeToString(mac(secret, body)), nil
+}
+
+// Verify cek signature di header terhadap body mentah (sebelum di-unwrap).
+func (k *Keyring) Verify(body []byte, headers amqp.Table) error {
+	sigHex, _ := headers[HeaderSignature].(string)
+	sigHex = strings.TrimPrefix(strings.TrimSpace(sigHex), "sha256=")
+	if sigHex == "" {
+		return ErrUnsigned
+	}
+	sig, err := hex.DecodeString(sigHex)
+	if err != nil {
+		return ErrBadSignature
+	}
+
+	if keyID, _ := headers[HeaderKeyID].(string); keyID != "" {
+		secret, ok := k.keys[keyID]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+		}
+		if !hmac.Equal(sig, mac(secret, body)) {
+			return ErrBadSignature
+		}
+		return nil
+	}
+
+	for _, secret := range k.keys {
+		if hmac.Equal(sig, mac(secret, body)) {
+			return nil
+		}
+	}
+	return ErrBadSignature
+}
+
+func mac(secret, body []byte) []byte {
+	m := hmac.New(sha256.New, secret)
+	m.Write(body)
+	return m.Sum(nil)
+}
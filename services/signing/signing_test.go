@@ -0,0 +1,98 @@
+package signing
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantNil bool
+		wantErr bool
+		wantIDs int
+	}{
+		{name: "empty disables verification", in: "  ", wantNil: true},
+		{name: "single key", in: "k1:secret", wantIDs: 1},
+		{name: "rotation with spaces", in: " k1:old , k2:new ", wantIDs: 2},
+		{name: "secret may contain colon", in: "k1:a:b", wantIDs: 1},
+		{name: "missing secret", in: "k1:", wantErr: true},
+		{name: "missing id", in: ":secret", wantErr: true},
+		{name: "no separator", in: "k1secret", wantErr: true},
+		{name: "duplicate id", in: "k1:a,k1:b", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseKeys(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.wantNil {
+				if k != nil {
+					t.Fatalf("keyring = %v, want nil", k)
+				}
+				return
+			}
+			if got := len(k.KeyIDs()); got != tt.wantIDs {
+				t.Fatalf("len(KeyIDs) = %d, want %d", got, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	k, err := ParseKeys("old:secret-old,new:secret-new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"ticketId":"T1","commandType":"REPAIR_PAYMENT"}`)
+	sigOld, _ := k.Sign("old", body)
+	sigNew, _ := k.Sign("new", body)
+
+	tests := []struct {
+		name    string
+		body    []byte
+		headers amqp.Table
+		want    error // nil = valid
+	}{
+		{name: "key id matches", body: body, headers: amqp.Table{HeaderSignature: sigNew, HeaderKeyID: "new"}},
+		{name: "no key id tries all keys", body: body, headers: amqp.Table{HeaderSignature: sigOld}},
+		{name: "sha256= prefix", body: body, headers: amqp.Table{HeaderSignature: "sha256=" + sigNew}},
+		{name: "surrounding spaces", body: body, headers: amqp.Table{HeaderSignature: "  " + sigNew + " "}},
+		{name: "missing signature", body: body, headers: amqp.Table{}, want: ErrUnsigned},
+		{name: "empty after prefix", body: body, headers: amqp.Table{HeaderSignature: "sha256="}, want: ErrUnsigned},
+		{name: "non-string header", body: body, headers: amqp.Table{HeaderSignature: int32(1)}, want: ErrUnsigned},
+		{name: "bad hex", body: body, headers: amqp.Table{HeaderSignature: "zz-not-hex"}, want: ErrBadSignature},
+		{name: "unknown key id", body: body, headers: amqp.Table{HeaderSignature: sigNew, HeaderKeyID: "gone"}, want: ErrUnknownKey},
+		{name: "key id does not try other keys", body: body, headers: amqp.Table{HeaderSignature: sigOld, HeaderKeyID: "new"}, want: ErrBadSignature},
+		{name: "tampered body", body: []byte(string(body) + " "), headers: amqp.Table{HeaderSignature: sigNew}, want: ErrBadSignature},
+		{name: "signature from unknown secret", body: body, headers: amqp.Table{HeaderSignature: "00ff"}, want: ErrBadSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := k.Verify(tt.body, tt.headers)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Verify = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignUnknownKey(t *testing.T) {
+	k, _ := ParseKeys("k1:secret")
+	if _, err := k.Sign("k2", []byte("x")); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Sign = %v, want ErrUnknownKey", err)
+	}
+}
@@ -0,0 +1,333 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"CommandHandler/types"
+)
+
+// jarak WAKTU_URUT / Tanggal antar baris hasil split (key tabel harus tetap unik)
+const splitStep = 10 * time.Millisecond
+
+// SplitPayment: 1 baris TR_SALES_PAYMENT_DETAIL (fromPaymentType) dipecah jadi beberapa baris
+// sesuai lines, begitu juga entri LOG_CASHDRAWER pasangannya. Baris asal dipakai untuk line
+// pertama, line berikutnya disalin dari baris asal. Semua dalam 1 transaksi.
+func (s *Service) SplitPayment(ctx context.Context, m Meta, p types.PayloadSplitPayment) (types.ResponseSplitPayment, error) {
+	// --- Validasi dasar ---
+	id, grandInt, err := parseBillRef(p.IDTRSalesHeader, p.GrandTotal)
+	if err != nil {
+		return types.ResponseSplitPayment{}, err
+	}
+	if strings.TrimSpace(p.FromPaymentType) == "" {
+		return types.ResponseSplitPayment{}, fmt.Errorf("missing fromPaymentType")
+	}
+	fromType := normalizePaymentType(p.FromPaymentType)
+	if len(p.Lines) < 2 {
+		return types.ResponseSplitPayment{}, fmt.Errorf("split needs at least 2 lines")
+	}
+	total := 0
+	lines := make([]types.SplitResult, len(p.Lines))
+	for i, l := range p.Lines {
+		if strings.TrimSpace(l.PaymentType) == "" {
+			return types.ResponseSplitPayment{}, fmt.Errorf("lines[%d]: missing paymentType", i)
+		}
+		if l.Amount <= 0 {
+			return types.ResponseSplitPayment{}, fmt.Errorf("lines[%d]: amount must be > 0", i)
+		}
+		lines[i] = types.SplitResult{TipeBayar: normalizePaymentType(l.PaymentType), Bayar: l.Amount}
+		total += l.Amount
+	}
+
+	// --- Transaksi ---
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return types.ResponseSplitPayment{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }() // aman walau sudah commit
+
+	// (1) Cari billcode
+	b, err := findBill(ctx, tx, id, grandInt)
+	if err != nil {
+		return types.ResponseSplitPayment{}, err
+	}
+	billcode := b.ID
+
+	// (2) Baris payment asal: harus tepat 1
+	const q2 = `
+SELECT
+  WAKTU_URUT,
+  CAST(BAYAR AS INT) AS BAYAR,
+  TIPE_BAYAR
+FROM TR_SALES_PAYMENT_DETAIL
+WHERE ID_TR_SALES_HEADER = @billcode
+  AND LTRIM(RTRIM(TIPE_BAYAR)) COLLATE SQL_Latin1_General_CP1_CI_AS
+      = LTRIM(RTRIM(@fromType))   COLLATE SQL_Latin1_General_CP1_CI_AS
+ORDER BY WAKTU_URUT
+`
+	details, err := queryPaymentDetails(ctx, tx, q2,
+		sql.Named("billcode", billcode),
+		sql.Named("fromType", fromType),
+	)
+	if err != nil {
+		return types.ResponseSplitPayment{}, fmt.Errorf("query payment detail failed: %w", err)
+	}
+	switch {
+	case len(details) == 0:
+		return types.ResponseSplitPayment{}, fmt.Errorf(
+			"payment detail not found: billcode=%s fromType=%s available=%v",
+			billcode, fromType, availablePaymentTypes(ctx, tx, billcode),
+		)
+	case len(details) > 1:
+		return types.ResponseSplitPayment{}, fmt.Errorf("billcode=%s has %d %s lines, only a single line can be split", billcode, len(details), fromType)
+	}
+	d := details[0]
+	if total != d.Bayar {
+		return types.ResponseSplitPayment{}, fmt.Errorf("lines total %d does not match original payment %d", total, d.Bayar)
+	}
+
+	// policy: batas umur transaksi yang boleh diubah
+	if err := m.Policy.CheckDaysBack(d.WaktuUrut, time.Now()); err != nil {
+		return types.ResponseSplitPayment{}, err
+	}
+	dateOnly := time.Date(d.WaktuUrut.Year(), d.WaktuUrut.Month(), d.WaktuUrut.Day(), 0, 0, 0, 0, d.WaktuUrut.Location())
+
+	// (3) LOG_CASHDRAWER pasangannya
+	online := isOrderOnline(b.OrderOnline)
+	keteranganLama := strings.TrimSpace(cashDrawerKeterangan(online, fromType))
+	const q3 = `
+SELECT TOP 1 Tanggal, Keterangan
+FROM LOG_CASHDRAWER
+WHERE DATEDIFF(day, Tanggal, @date) = 0
+  AND CashIn = @bayar
+  AND LTRIM(RTRIM(Keterangan)) = @keterangan
+`
+	var tanggal time.Time
+	var keteranganAsli string
+	if scanErr := tx.QueryRowContext(
+		ctx, q3,
+		sql.Named("date", dateOnly),
+		sql.Named("bayar", d.Bayar),
+		sql.Named("keterangan", keteranganLama),
+	).Scan(&tanggal, &keteranganAsli); scanErr != nil {
+		if errors.Is(scanErr, sql.ErrNoRows) {
+			return types.ResponseSplitPayment{}, fmt.Errorf(
+				"log cashdrawer not found: date=%s bayar=%d keterangan=%s",
+				dateOnly.Format("2006-01-02"), d.Bayar, keteranganLama,
+			)
+		}
+		return types.ResponseSplitPayment{}, fmt.Errorf("query log cashdrawer failed: %w", scanErr)
+	}
+	for i := range lines {
+		lines[i].LogCashdrawer = strings.TrimSpace(cashDrawerKeterangan(online, lines[i].TipeBayar))
+	}
+
+	detailWhere := `ID_TR_SALES_HEADER = @billcode AND ` + sameTime("WAKTU_URUT", "waktuUrut")
+	detailArgs := []any{sql.Named("billcode", billcode), sql.Named("waktuUrut", d.WaktuUrut)}
+	drawerWhere := sameTime("Tanggal", "tanggal") + ` AND CashIn = @bayar AND LTRIM(RTRIM(Keterangan)) = @keterangan`
+	drawerArgs := []any{sql.Named("tanggal", tanggal), sql.Named("bayar", d.Bayar), sql.Named("keterangan", keteranganLama)}
+
+	var changes []types.RowChange
+
+	// (4) Line ke-2 dst: salin baris asal (sebelum baris asal diubah)
+	for i, l := range lines[1:] {
+		step := time.Duration(i+1) * splitStep
+		waktu := d.WaktuUrut.Add(step)
+		if err := insertCopy(ctx, tx, "TR_SALES_PAYMENT_DETAIL", detailWhere, detailArgs, map[string]any{
+			"WAKTU_URUT": waktu,
+			"TIPE_BAYAR": l.TipeBayar,
+			"BAYAR":      l.Bayar,
+		}); err != nil {
+			return types.ResponseSplitPayment{}, fmt.Errorf("insert payment detail %s failed: %w", l.TipeBayar, err)
+		}
+		tgl := tanggal.Add(step)
+		if err := insertCopy(ctx, tx, "LOG_CASHDRAWER", drawerWhere, drawerArgs, map[string]any{
+			"Tanggal":    tgl,
+			"CashIn":     l.Bayar,
+			"Keterangan": l.LogCashdrawer,
+		}); err != nil {
+			return types.ResponseSplitPayment{}, fmt.Errorf("insert LOG_CASHDRAWER %s failed: %w", l.LogCashdrawer, err)
+		}
+		changes = append(changes,
+			types.RowChange{
+				Table: "TR_SALES_PAYMENT_DETAIL",
+				Key:   map[string]any{"ID_TR_SALES_HEADER": billcode, "WAKTU_URUT": waktu},
+				After: map[string]any{"TIPE_BAYAR": l.TipeBayar, "BAYAR": l.Bayar},
+			},
+			types.RowChange{
+				Table: "LOG_CASHDRAWER",
+				Key:   map[string]any{"Tanggal": tgl, "CashIn": l.Bayar},
+				After: map[string]any{"Keterangan": l.LogCashdrawer, "CashIn": l.Bayar},
+			},
+		)
+	}
+
+	// (5) Baris asal jadi line pertama
+	first := lines[0]
+	// Salinan di (4) bergeser >= splitStep, jadi tidak ikut kena predikat baris asal.
+	q5 := `
+WITH TargetRow AS (
+  SELECT TOP 1 *
+  FROM TR_SALES_PAYMENT_DETAIL
+  WHERE ` + detailWhere + `
+)
+UPDATE TargetRow
+SET TIPE_BAYAR = @toType, BAYAR = @toBayar;
+`
+	res, err := tx.ExecContext(ctx, q5, append(detailArgs,
+		sql.Named("toType", first.TipeBayar),
+		sql.Named("toBayar", first.Bayar),
+	)...)
+	if err != nil {
+		return types.ResponseSplitPayment{}, fmt.Errorf("update payment detail failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return types.ResponseSplitPayment{}, fmt.Errorf("update payment detail affected %d rows, expected 1", n)
+	}
+	q5log := `
+WITH TargetRow AS (
+  SELECT TOP 1 *
+  FROM LOG_CASHDRAWER
+  WHERE ` + drawerWhere + `
+)
+UPDATE TargetRow
+SET CashIn = @toBayar, Keterangan = @toKeterangan;
+`
+	res, err = tx.ExecContext(ctx, q5log, append(drawerArgs,
+		sql.Named("toBayar", first.Bayar),
+		sql.Named("toKeterangan", first.LogCashdrawer),
+	)...)
+	if err != nil {
+		return types.ResponseSplitPayment{}, fmt.Errorf("update LOG_CASHDRAWER failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return types.ResponseSplitPayment{}, fmt.Errorf("update LOG_CASHDRAWER affected %d rows, expected 1", n)
+	}
+	changes = append([]types.RowChange{
+		{
+			Table:  "TR_SALES_PAYMENT_DETAIL",
+			Key:    d.key(billcode),
+			Before: map[string]any{"TIPE_BAYAR": d.TipeBayar, "BAYAR": d.Bayar},
+			After:  map[string]any{"TIPE_BAYAR": first.TipeBayar, "BAYAR": first.Bayar},
+		},
+		{
+			Table:  "LOG_CASHDRAWER",
+			Key:    map[string]any{"Tanggal": tanggal, "CashIn": d.Bayar},
+			Before: map[string]any{"Keterangan": keteranganAsli, "CashIn": d.Bayar},
+			After:  map[string]any{"Keterangan": first.LogCashdrawer, "CashIn": first.Bayar},
+		},
+	}, changes...)
+
+	// (6) Reset status_kirim
+	const q6 = `
+UPDATE TR_SALES_HEADER
+SET status_kirim = '0'
+WHERE ID_TR_SALES_HEADER = @billcode
+`
+	if _, err = tx.ExecContext(ctx, q6, sql.Named("billcode", billcode)); err != nil {
+		return types.ResponseSplitPayment{}, fmt.Errorf("reset status_kirim failed: %w", err)
+	}
+	changes = append(changes, headerChange(b, map[string]any{"status_kirim": "0"}))
+
+	// Audit trail (ikut transaksi; dry-run ikut ke-rollback)
+	if err = writeAudit(ctx, tx, m, changes); err != nil {
+		return types.ResponseSplitPayment{}, err
+	}
+
+	out := types.ResponseSplitPayment{
+		Billcode: billcode,
+		FromType: fromType,
+		Bayar:    d.Bayar,
+		Lines:    lines,
+		DryRun:   m.DryRun,
+		Changes:  changes,
+	}
+
+	// Commit (atau rollback kalau dry-run)
+	if err = finish(ctx, tx, m, out); err != nil {
+		return types.ResponseSplitPayment{}, fmt.Errorf("commit failed: %w", err)
+	}
+	return out, nil
+}
+
+// insertCopy: INSERT salinan 1 baris table (WHERE where), kolom di set diganti nilainya.
+// Daftar kolom dari sys.columns (tanpa identity/computed/rowversion), jadi kolom lain yang
+// tidak dikenal service ikut tersalin apa adanya.
+func insertCopy(ctx context.Context, tx *sql.Tx, table, where string, args []any, set map[string]any) error {
+	cols, err := copyableColumns(ctx, tx, table)
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(cols))
+	sel := make([]string, len(cols))
+	args = append([]any(nil), args...)
+	used := 0
+	for i, c := range cols {
+		names[i] = quoteIdent(c)
+		sel[i] = names[i]
+		for k, v := range set {
+			if strings.EqualFold(k, c) {
+				p := "set" + strconv.Itoa(i)
+				sel[i] = "@" + p
+				args = append(args, sql.Named(p, v))
+				used++
+				break
+			}
+		}
+	}
+	if used != len(set) {
+		return fmt.Errorf("%s: some columns to set do not exist", table)
+	}
+
+	q := fmt.Sprintf(`
+INSERT INTO %s (%s)
+SELECT TOP 1 %s
+FROM %s
+WHERE %s
+`, table, strings.Join(names, ", "), strings.Join(sel, ", "), table, where)
+	res, err := tx.ExecContext(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return fmt.Errorf("%s: copy affected %d rows, expected 1", table, n)
+	}
+	return nil
+}
+
+func copyableColumns(ctx context.Context, tx *sql.Tx, table string) ([]string, error) {
+	const q = `
+SELECT name
+FROM sys.columns
+WHERE object_id = OBJECT_ID(@table)
+  AND is_identity = 0
+  AND is_computed = 0
+  AND system_type_id <> 189 -- timestamp / rowversion
+ORDER BY column_id
+`
+	rows, err := tx.QueryContext(ctx, q, sql.Named("table", table))
+	if err != nil {
+		return nil, fmt.Errorf("query columns %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		cols = append(cols, c)
+	}
+	if len(cols) == 0 && rows.Err() == nil {
+		return nil, fmt.Errorf("table %s not found", table)
+	}
+	return cols, rows.Err()
+}
+
+func quoteIdent(s string) string { return "[" + strings.ReplaceAll(s, "]", "]]") + "]" }
@@ -5,7 +5,6 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 
@@ -19,38 +18,20 @@ type Service struct{ DB *sql.DB }
 func New(db *sql.DB) *Service { return &Service{DB: db} }
 
 // RepairPaymentMethod: strict; jika langkah penting gagal → return error (dispatcher mark FAILED)
-func (s *Service) RepairPaymentMethod(ctx context.Context, p types.PayloadRepairPayment) (types.ResponseRepairPayment, error) {
+func (s *Service) RepairPaymentMethod(ctx context.Context, m Meta, p types.PayloadRepairPayment) (types.ResponseRepairPayment, error) {
 	// --- Validasi dasar ---
-	id := strings.TrimSpace(p.IDTRSalesHeader)
-	gt := strings.TrimSpace(p.GrandTotal)
-	if id == "" || gt == "" {
-		return types.ResponseRepairPayment{}, fmt.Errorf("missing ID_TR_SALES_HEADER or grandTotal")
-	}
-	if len(id) < 12 {
-		return types.ResponseRepairPayment{}, fmt.Errorf("ID_TR_SALES_HEADER must be >= 12 chars")
-	}
-	grandInt, convErr := strconv.Atoi(gt)
-	if convErr != nil {
-		return types.ResponseRepairPayment{}, fmt.Errorf("grandTotal must be an integer string: %v", convErr)
+	id, grandInt, err := parseBillRef(p.IDTRSalesHeader, p.GrandTotal)
+	if err != nil {
+		return types.ResponseRepairPayment{}, err
 	}
 
 	// Normalisasi tipe bayar (key → value); kalau sudah value biarkan
-	fromType := string(p.FromPaymentType)
-	toType := string(p.ToPaymentType)
-	if v, err := utils.GetPaymentValue(fromType); err == nil && v != "" {
-		fromType = v
-	}
-	if v, err := utils.GetPaymentValue(toType); err == nil && v != "" {
-		toType = v
-	}
-	fromType = strings.TrimSpace(fromType)
-	toType = strings.TrimSpace(toType)
-
-	left6 := id[:6]
-	right6 := id[len(id)-6:]
+	fromType := normalizePaymentType(p.FromPaymentType)
+	toType := normalizePaymentType(p.ToPaymentType)
 
 	// default return fields
 	logCashdrawer := ""
+	var changes []types.RowChange
 
 	// --- Transaksi ---
 	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{})
@@ -60,28 +41,14 @@ func (s *Service) RepairPaymentMethod(ctx context.Context, p types.PayloadRepair
 	defer func() { _ = tx.Rollback() }() // aman walau sudah commit
 
 	// (1) Cari billcode di header (cast Grand_Total → INT supaya aman jika DECIMAL)
-	var billcode string
-	var orderOnline sql.NullString
-	const q1 = `
-SELECT TOP 1 ID_TR_SALES_HEADER, order_online
-FROM TR_SALES_HEADER
-WHERE LEFT(LTRIM(RTRIM(ID_TR_SALES_HEADER)), 6) = @left
-  AND RIGHT(LTRIM(RTRIM(ID_TR_SALES_HEADER)), 6) = @right
-  AND CAST(Grand_Total AS INT) = @grandTotal
-`
-	if scanErr := tx.QueryRowContext(
-		ctx, q1,
-		sql.Named("left", left6),
-		sql.Named("right", right6),
-		sql.Named("grandTotal", grandInt),
-	).Scan(&billcode, &orderOnline); scanErr != nil {
-		if errors.Is(scanErr, sql.ErrNoRows) {
-			return types.ResponseRepairPayment{}, fmt.Errorf("billcode not found: left=%s right=%s grandTotal=%d", left6, right6, grandInt)
-		}
-		return types.ResponseRepairPayment{}, fmt.Errorf("query header failed: %w", scanErr)
+	b, err := findBill(ctx, tx, id, grandInt)
+	if err != nil {
+		return types.ResponseRepairPayment{}, err
 	}
+	billcode := b.ID
 
 	// (2) Update order_online
+	directSelling := utils.IsDirectSelling(p.DirectSelling)
 	const q2 = `
 UPDATE TR_SALES_HEADER
 SET order_online = @directSelling 
@@ -90,53 +57,45 @@ WHERE ID_TR_SALES_HEADER = @billcode
 	if _, err = tx.ExecContext(
 		ctx, q2,
 		sql.Named("billcode", billcode),
-		sql.Named("directSelling", utils.IsDirectSelling(p.DirectSelling)),
+		sql.Named("directSelling", directSelling),
 	); err != nil {
 		return types.ResponseRepairPayment{}, fmt.Errorf("update order_online failed: %w", err)
 	}
 
-	// (3) Ambil detail pembayaran (paksa CI collation) + CAST BAYAR ke INT
-	var waktuUrut time.Time
-	var bayar int
+	// (3) Ambil detail pembayaran (paksa CI collation) + CAST BAYAR ke INT.
+	// Semua baris yang cocok ikut diambil karena (4) meng-update semuanya; baris pertama dipakai untuk LOG_CASHDRAWER.
 	const q3 = `
-SELECT TOP 1 
-  WAKTU_URUT, 
-  CAST(BAYAR AS INT) AS BAYAR
+SELECT
+  WAKTU_URUT,
+  CAST(BAYAR AS INT) AS BAYAR,
+  TIPE_BAYAR
 FROM TR_SALES_PAYMENT_DETAIL
 WHERE ID_TR_SALES_HEADER = @billcode
   AND LTRIM(RTRIM(TIPE_BAYAR)) COLLATE SQL_Latin1_General_CP1_CI_AS
       = LTRIM(RTRIM(@fromType))   COLLATE SQL_Latin1_General_CP1_CI_AS
+ORDER BY WAKTU_URUT
 `
-	if scanErr := tx.QueryRowContext(
-		ctx, q3,
+	details, err := queryPaymentDetails(ctx, tx, q3,
 		sql.Named("billcode", billcode),
 		sql.Named("fromType", fromType),
-	).Scan(&waktuUrut, &bayar); scanErr != nil {
+	)
+	if err != nil {
+		return types.ResponseRepairPayment{}, fmt.Errorf("query payment detail failed: %w", err)
+	}
+	if len(details) == 0 {
+		// Diagnostik: list tipe bayar yang tersedia pada billcode ini
+		got := availablePaymentTypes(ctx, tx, billcode)
+		return types.ResponseRepairPayment{}, fmt.Errorf(
+			"payment detail not found: billcode=%s fromType=%s available=%v",
+			billcode, fromType, got,
+		)
+	}
+	waktuUrut := details[0].WaktuUrut
+	bayar := details[0].Bayar
 
-		if errors.Is(scanErr, sql.ErrNoRows) {
-			// Diagnostik: list tipe bayar yang tersedia pada billcode ini
-			rows, _ := tx.QueryContext(ctx, `
-				SELECT DISTINCT LTRIM(RTRIM(TIPE_BAYAR)) AS tipe, COUNT(*) cnt
-				FROM TR_SALES_PAYMENT_DETAIL
-				WHERE ID_TR_SALES_HEADER = @billcode
-				GROUP BY LTRIM(RTRIM(TIPE_BAYAR))
-			`, sql.Named("billcode", billcode))
-			var got []string
-			for rows != nil && rows.Next() {
-				var tipe string
-				var cnt int
-				_ = rows.Scan(&tipe, &cnt)
-				got = append(got, fmt.Sprintf("%s(%d)", strings.ToUpper(strings.TrimSpace(tipe)), cnt))
-			}
-			if rows != nil {
-				rows.Close()
-			}
-			return types.ResponseRepairPayment{}, fmt.Errorf(
-				"payment detail not found: billcode=%s fromType=%s available=%v",
-				billcode, fromType, got,
-			)
-		}
-		return types.ResponseRepairPayment{}, fmt.Errorf("query payment detail failed: %w", scanErr)
+	// policy: batas umur transaksi yang boleh diubah
+	if err := m.Policy.CheckDaysBack(waktuUrut, time.Now()); err != nil {
+		return types.ResponseRepairPayment{}, err
 	}
 
 	// set date-only agar cocok DATEDIFF(day, ...)
@@ -160,30 +119,25 @@ WHERE ID_TR_SALES_HEADER = @billcode
 	}
 
 	// (5) Update LOG_CASHDRAWER
-	oldIsOnline := orderOnline.Valid && strings.TrimSpace(orderOnline.String) == "1"
-	keteranganLama := "Online"
-	if !oldIsOnline {
-		keteranganLama = utils.CashDrawerLogDescription(fromType)
-	}
-	keteranganBaru := "Online"
-	if !p.DirectSelling {
-		keteranganBaru = utils.CashDrawerLogDescription(toType)
-	}
+	oldIsOnline := isOrderOnline(b.OrderOnline)
+	keteranganLama := strings.TrimSpace(cashDrawerKeterangan(oldIsOnline, fromType))
+	keteranganBaru := strings.TrimSpace(cashDrawerKeterangan(p.DirectSelling, toType))
 
 	const q5sel = `
-SELECT TOP 1 Keterangan
+SELECT TOP 1 Tanggal, Keterangan
 FROM LOG_CASHDRAWER
 WHERE DATEDIFF(day, Tanggal, @date) = 0
   AND CashIn = @bayar
   AND LTRIM(RTRIM(Keterangan)) = @keteranganLama
 `
+	var tanggal time.Time
 	var exists string
 	if scanErr := tx.QueryRowContext(
 		ctx, q5sel,
 		sql.Named("date", dateOnly),
 		sql.Named("bayar", bayar),
-		sql.Named("keteranganLama", strings.TrimSpace(keteranganLama)),
-	).Scan(&exists); scanErr != nil {
+		sql.Named("keteranganLama", keteranganLama),
+	).Scan(&tanggal, &exists); scanErr != nil {
 		if errors.Is(scanErr, sql.ErrNoRows) {
 			return types.ResponseRepairPayment{}, fmt.Errorf(
 				"log cashdrawer not found: date=%s bayar=%d keteranganLama=%s (oldIsOnline=%v)",
@@ -193,26 +147,30 @@ WHERE DATEDIFF(day, Tanggal, @date) = 0
 		return types.ResponseRepairPayment{}, fmt.Errorf("query log cashdrawer failed: %w", scanErr)
 	}
 
-	const q5upd = `
+	q5upd := `
 WITH TargetRow AS (
   SELECT TOP 1 *
   FROM LOG_CASHDRAWER
-  WHERE DATEDIFF(day, Tanggal, @date) = 0
+  WHERE ` + sameTime("Tanggal", "tanggal") + `
     AND CashIn = @bayar
     AND LTRIM(RTRIM(Keterangan)) = @keteranganLama
 )
 UPDATE TargetRow
 SET Keterangan = @keteranganBaru;
 `
-	if _, err = tx.ExecContext(
+	res5, err := tx.ExecContext(
 		ctx, q5upd,
-		sql.Named("date", dateOnly),
+		sql.Named("tanggal", tanggal),
 		sql.Named("bayar", bayar),
-		sql.Named("keteranganLama", strings.TrimSpace(keteranganLama)),
-		sql.Named("keteranganBaru", strings.TrimSpace(keteranganBaru)),
-	); err != nil {
+		sql.Named("keteranganLama", keteranganLama),
+		sql.Named("keteranganBaru", keteranganBaru),
+	)
+	if err != nil {
 		return types.ResponseRepairPayment{}, fmt.Errorf("update LOG_CASHDRAWER failed: %w", err)
 	}
+	if n, _ := res5.RowsAffected(); n != 1 {
+		return types.ResponseRepairPayment{}, fmt.Errorf("update LOG_CASHDRAWER affected %d rows, expected 1", n)
+	}
 	logCashdrawer = keteranganBaru
 
 	// (6) Reset status_kirim
@@ -225,13 +183,41 @@ WHERE ID_TR_SALES_HEADER = @billcode
 		return types.ResponseRepairPayment{}, fmt.Errorf("reset status_kirim failed: %w", err)
 	}
 
-	// Commit
-	if err = tx.Commit(); err != nil {
-		return types.ResponseRepairPayment{}, fmt.Errorf("commit failed: %w", err)
-	}
-
-	return types.ResponseRepairPayment{
+	// Snapshot before/after semua baris yang disentuh
+	changes = append(changes, headerChange(b,
+		map[string]any{"order_online": directSelling, "status_kirim": "0"},
+	))
+	for _, d := range details {
+		changes = append(changes, types.RowChange{
+			Table:  "TR_SALES_PAYMENT_DETAIL",
+			Key:    d.key(billcode),
+			Before: map[string]any{"TIPE_BAYAR": d.TipeBayar},
+			After:  map[string]any{"TIPE_BAYAR": toType},
+		})
+	}
+	changes = append(changes, types.RowChange{
+		Table:  "LOG_CASHDRAWER",
+		Key:    map[string]any{"Tanggal": tanggal, "CashIn": bayar},
+		Before: map[string]any{"Keterangan": exists},
+		After:  map[string]any{"Keterangan": keteranganBaru},
+	})
+
+	// Audit trail (ikut transaksi; dry-run ikut ke-rollback)
+	if err = writeAudit(ctx, tx, m, changes); err != nil {
+		return types.ResponseRepairPayment{}, err
+	}
+
+	res := types.ResponseRepairPayment{
+		Billcode:      billcode,
 		TipeBayar:     toType,
 		LogCashdrawer: logCashdrawer,
-	}, nil
+		DryRun:        m.DryRun,
+		Changes:       changes,
+	}
+
+	// Commit (atau rollback kalau dry-run)
+	if err = finish(ctx, tx, m, res); err != nil {
+		return types.ResponseRepairPayment{}, fmt.Errorf("commit failed: %w", err)
+	}
+	return res, nil
 }
@@ -0,0 +1,10 @@
+package types
+
+// RowChange: snapshot satu baris yang diubah/dihapus oleh command.
+// Key = kolom untuk menemukan baris, Before/After = nilai kolom yang berubah (After nil kalau dihapus).
+type RowChange struct {
+	Table  string         `json:"table"`
+	Key    map[string]any `json:"key"`
+	Before map[string]any `json:"before"`
+	After  map[string]any `json:"after,omitempty"`
+}
@@ -1,10 +1,25 @@
 package types
 
+import (
+	"strconv"
+	"strings"
+)
+
 type CommandType string
 
 const (
-	CommandRepairPayment CommandType = "REPAIR_PAYMENT"
-	CommandDeletePayment CommandType = "DELETE_PAYMENT"
+	CommandRepairPayment  CommandType = "REPAIR_PAYMENT"
+	CommandDeletePayment  CommandType = "DELETE_PAYMENT"
+	CommandRevertTicket   CommandType = "REVERT_TICKET"
+	CommandResend         CommandType = "RESEND_TRANSACTION"
+	CommandSplitPayment   CommandType = "SPLIT_PAYMENT"
+	CommandSetOrderOnline CommandType = "SET_ORDER_ONLINE"
+
+	CommandReconcileCashdrawer CommandType = "RECONCILE_CASHDRAWER" // read-only
+	CommandFixCashdrawer       CommandType = "FIX_CASHDRAWER"
+
+	CommandListDeadLetters    CommandType = "LIST_DEAD_LETTERS"
+	CommandRequeueDeadLetters CommandType = "REQUEUE_DEAD_LETTERS"
 )
 
 type Command struct {
@@ -12,4 +27,36 @@ type Command struct {
 	TicketID    string      `json:"ticketId"`
 	CommandType CommandType `json:"commandType"`
 	Payload     any         `json:"payload"`
+	DryRun      bool        `json:"dryRun"` // preview: jalankan semua query lalu rollback
+
+	Attempt int `json:"-"` // jumlah retry sebelumnya (dari header x-retry-count), diisi consumer
+}
+
+// BillKey: kunci bill dari payload untuk menjaga urutan command per bill. Dibentuk sama seperti
+// bill di-resolve (findBill): 6 karakter kiri/kanan ID_TR_SALES_HEADER + grandTotal, supaya ID yang
+// beda di tengah tapi menunjuk bill yang sama tetap masuk lane yang sama. "" kalau tidak lengkap.
+func (c Command) BillKey() string {
+	m, ok := c.Payload.(map[string]any)
+	if !ok {
+		return ""
+	}
+	id, _ := m["ID_TR_SALES_HEADER"].(string)
+	gt, _ := m["grandTotal"].(string)
+	id = strings.ToUpper(strings.TrimSpace(id))
+	grandInt, err := strconv.Atoi(strings.TrimSpace(gt))
+	if len(id) < 12 || err != nil {
+		return ""
+	}
+	return id[:6] + "|" + id[len(id)-6:] + "|" + strconv.Itoa(grandInt)
+}
+
+// Exclusive: command yang menyentuh banyak bill, atau bill yang tidak ketahuan dari payload
+// (REVERT_TICKET, FIX_CASHDRAWER, RESEND_TRANSACTION tanpa grandTotal). Tidak bisa diberi lane per
+// bill, jadi consumer menjalankannya sendirian: tunggu semua command sebelumnya selesai dulu.
+func (c Command) Exclusive() bool {
+	switch c.CommandType {
+	case CommandRevertTicket, CommandFixCashdrawer, CommandResend:
+		return c.BillKey() == ""
+	}
+	return false
 }
@@ -0,0 +1,12 @@
+package types
+
+// DeadLetter: ringkasan pesan di DLQ (untuk LIST/REQUEUE_DEAD_LETTERS).
+type DeadLetter struct {
+	TicketID   string `json:"ticketId,omitempty"`
+	Reason     string `json:"reason"`
+	Stack      string `json:"stack,omitempty"`
+	FailedAt   string `json:"failedAt,omitempty"`
+	RoutingKey string `json:"routingKey"`
+	Body       string `json:"body"`
+	Error      string `json:"error,omitempty"` // REQUEUE_DEAD_LETTERS: kenapa pesan ini dilewati
+}
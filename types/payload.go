@@ -12,4 +12,75 @@ type PayloadRepairPayment struct {
 type PayloadDeletePayment struct {
 	SenderNIK       string `json:"senderNik"` // kalau di DELETE juga wajib, samakan
 	IDTRSalesHeader string `json:"ID_TR_SALES_HEADER"`
+	GrandTotal      string `json:"grandTotal"`
+	PaymentType     string `json:"paymentType"` // baris payment yang salah (key atau value)
+}
+
+type PayloadRevertTicket struct {
+	SenderNIK      string `json:"senderNik"`
+	TargetTicketID string `json:"targetTicketId"` // ticket yang mau dibatalkan
+}
+
+type PayloadDeadLetters struct {
+	SenderNIK string   `json:"senderNik"`
+	Limit     int      `json:"limit"`     // default 100
+	TicketIDs []string `json:"ticketIds"` // REQUEUE saja; kosong = semua (maks limit)
+}
+
+// PayloadSplitPayment: pecah 1 baris payment (fromPaymentType) jadi beberapa baris.
+// Total amount lines harus sama dengan BAYAR baris asal.
+type PayloadSplitPayment struct {
+	SenderNIK       string      `json:"senderNik"`
+	IDTRSalesHeader string      `json:"ID_TR_SALES_HEADER"`
+	GrandTotal      string      `json:"grandTotal"`
+	FromPaymentType string      `json:"fromPaymentType"`
+	Lines           []SplitLine `json:"lines"` // minimal 2
+}
+
+type SplitLine struct {
+	PaymentType string `json:"paymentType"` // key atau value (DBCA / D.BCA)
+	Amount      int    `json:"amount"`
+}
+
+type PayloadSetOrderOnline struct {
+	SenderNIK       string `json:"senderNik"`
+	IDTRSalesHeader string `json:"ID_TR_SALES_HEADER"`
+	GrandTotal      string `json:"grandTotal"`
+	DirectSelling   *bool  `json:"directSelling"` // nilai baru order_online (wajib; nil = tidak dikirim)
+}
+
+type PayloadReconcileCashdrawer struct {
+	SenderNIK string `json:"senderNik"`
+	Date      string `json:"date"` // YYYY-MM-DD
+}
+
+type PayloadFixCashdrawer struct {
+	SenderNIK string `json:"senderNik"`
+	Date      string `json:"date"`    // YYYY-MM-DD
+	MaxRows   int    `json:"maxRows"` // batas baris yang boleh diubah (default 50)
 }
+
+// PayloadResendTransaction: pilih salah satu — 1 bill, beberapa bill, atau rentang tanggal.
+type PayloadResendTransaction struct {
+	SenderNIK       string   `json:"senderNik"`
+	IDTRSalesHeader string   `json:"ID_TR_SALES_HEADER"` // 1 billcode (exact)
+	Billcodes       []string `json:"billcodes"`          // beberapa billcode (exact)
+	DateFrom        string   `json:"dateFrom"`           // YYYY-MM-DD, inklusif
+	DateTo          string   `json:"dateTo"`             // YYYY-MM-DD, inklusif (kosong = sama dengan dateFrom)
+	MaxRows         int      `json:"maxRows"`            // batas aman jumlah header (default 200)
+}
+
+// Payload: semua payload command wajib bisa mengembalikan NIK pengirim.
+type Payload interface {
+	Sender() string
+}
+
+func (p PayloadRepairPayment) Sender() string       { return p.SenderNIK }
+func (p PayloadDeletePayment) Sender() string       { return p.SenderNIK }
+func (p PayloadRevertTicket) Sender() string        { return p.SenderNIK }
+func (p PayloadDeadLetters) Sender() string         { return p.SenderNIK }
+func (p PayloadResendTransaction) Sender() string   { return p.SenderNIK }
+func (p PayloadSplitPayment) Sender() string        { return p.SenderNIK }
+func (p PayloadSetOrderOnline) Sender() string      { return p.SenderNIK }
+func (p PayloadReconcileCashdrawer) Sender() string { return p.SenderNIK }
+func (p PayloadFixCashdrawer) Sender() string       { return p.SenderNIK }
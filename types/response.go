@@ -1,13 +1,136 @@
 package types
 
+import "time"
+
 type CommonResponse struct {
 	TypeCommand CommandType `json:"typeCommand"`
 	Handler     string      `json:"handler"`
-	Status      string      `json:"status"` // "success" / "failed"
+	Status      string      `json:"status"` // "success" / "failed" / "retry"
 	Data        any         `json:"data"`
 }
 
+// Status CommonResponse
+const (
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+	StatusRetry   = "retry"   // error transient, consumer menjadwalkan retry
+	StatusAborted = "aborted" // dibatalkan shutdown di tengah jalan, consumer requeue (belum ada hasil)
+)
+
 type ResponseRepairPayment struct {
+	Billcode      string      `json:"billcode"`
+	TipeBayar     string      `json:"tipeBayar"`
+	LogCashdrawer string      `json:"logCashdrawer"`
+	DryRun        bool        `json:"dryRun,omitempty"`
+	Changes       []RowChange `json:"changes,omitempty"`
+}
+
+type ResponseDeletePayment struct {
+	Billcode      string      `json:"billcode"`
+	TipeBayar     string      `json:"tipeBayar"`
+	Bayar         int         `json:"bayar"`
+	LogCashdrawer string      `json:"logCashdrawer"`
+	DryRun        bool        `json:"dryRun,omitempty"`
+	Changes       []RowChange `json:"changes,omitempty"`
+}
+
+type ResponseSplitPayment struct {
+	Billcode string        `json:"billcode"`
+	FromType string        `json:"fromType"`
+	Bayar    int           `json:"bayar"` // BAYAR baris asal (= total lines)
+	Lines    []SplitResult `json:"lines"`
+	DryRun   bool          `json:"dryRun,omitempty"`
+	Changes  []RowChange   `json:"changes,omitempty"`
+}
+
+type SplitResult struct {
 	TipeBayar     string `json:"tipeBayar"`
+	Bayar         int    `json:"bayar"`
 	LogCashdrawer string `json:"logCashdrawer"`
 }
+
+type ResponseSetOrderOnline struct {
+	Billcode      string      `json:"billcode"`
+	OrderOnline   string      `json:"orderOnline"`   // nilai baru ("1" / "0")
+	LogCashdrawer []string    `json:"logCashdrawer"` // Keterangan baru per baris payment
+	DryRun        bool        `json:"dryRun,omitempty"`
+	Changes       []RowChange `json:"changes,omitempty"`
+}
+
+// ResponseReconcileCashdrawer: TR_SALES_PAYMENT_DETAIL vs LOG_CASHDRAWER untuk 1 tanggal,
+// per Keterangan. Difference = drawer - payment (0 = cocok).
+type ResponseReconcileCashdrawer struct {
+	Date          string            `json:"date"`
+	Balanced      bool              `json:"balanced"`
+	Discrepancies int               `json:"discrepancies"` // jumlah group yang total / jumlah barisnya berbeda
+	PaymentTotal  int               `json:"paymentTotal"`
+	DrawerTotal   int               `json:"drawerTotal"`
+	Groups        []CashdrawerGroup `json:"groups"`
+}
+
+type CashdrawerGroup struct {
+	Keterangan   string `json:"keterangan"`
+	PaymentTotal int    `json:"paymentTotal"`
+	PaymentCount int    `json:"paymentCount"`
+	DrawerTotal  int    `json:"drawerTotal"`
+	DrawerCount  int    `json:"drawerCount"`
+	Difference   int    `json:"difference"`
+}
+
+// ResponseFixCashdrawer: baris LOG_CASHDRAWER yang Keterangan-nya dibetulkan, plus sisa yang
+// tidak bisa dipasangkan (nominal tidak ada pasangannya → perlu dicek manual).
+type ResponseFixCashdrawer struct {
+	Date              string            `json:"date"`
+	Fixed             int               `json:"fixed"`
+	Rows              []CashdrawerFix   `json:"rows"`
+	UnmatchedPayments []CashdrawerEntry `json:"unmatchedPayments,omitempty"`
+	UnmatchedDrawer   []CashdrawerEntry `json:"unmatchedDrawer,omitempty"`
+	DryRun            bool              `json:"dryRun,omitempty"`
+}
+
+type CashdrawerFix struct {
+	Billcode string    `json:"billcode"` // payment sumber kebenaran
+	Tanggal  time.Time `json:"tanggal"`
+	CashIn   int       `json:"cashIn"`
+	Before   string    `json:"before"`
+	After    string    `json:"after"`
+}
+
+type CashdrawerEntry struct {
+	Billcode   string    `json:"billcode,omitempty"`
+	Tanggal    time.Time `json:"tanggal"`
+	Amount     int       `json:"amount"`
+	Keterangan string    `json:"keterangan"`
+}
+
+type ResponseRevertTicket struct {
+	TargetTicketID string      `json:"targetTicketId"`
+	DryRun         bool        `json:"dryRun,omitempty"`
+	Changes        []RowChange `json:"changes,omitempty"`
+}
+
+type ResponseResendTransaction struct {
+	Count          int      `json:"count"`                    // header yang di-flag status_kirim = '0'
+	Billcodes      []string `json:"billcodes"`                // ID header yang di-flag
+	AlreadyPending []string `json:"alreadyPending,omitempty"` // status_kirim sudah '0', tidak diubah
+	NotFound       []string `json:"notFound,omitempty"`       // billcode yang diminta tapi tidak ada
+	DryRun         bool     `json:"dryRun,omitempty"`
+}
+
+type ResponseDeadLetters struct {
+	Count    int          `json:"count"`
+	Messages []DeadLetter `json:"messages"`
+	Skipped  []DeadLetter `json:"skipped,omitempty"` // requeue: tidak bisa dikirim ulang, tetap di DLQ
+}
+
+// Error code di status message / respons gagal
+const (
+	ErrCodeUnsupportedCommand = "UNSUPPORTED_COMMAND"
+	ErrCodeInvalidPayload     = "INVALID_PAYLOAD"
+	ErrCodeMissingSender      = "MISSING_SENDER"
+	ErrCodeValidation         = "VALIDATION_FAILED"
+	ErrCodeExecution          = "EXECUTION_FAILED"
+	ErrCodeTransient          = "TRANSIENT_ERROR"
+	ErrCodeRetryExhausted     = "RETRY_EXHAUSTED"
+	ErrCodeStoreMismatch      = "STORE_MISMATCH"
+)
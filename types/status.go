@@ -0,0 +1,36 @@
+package types
+
+import "time"
+
+// Lifecycle status ticket: RECEIVED → PROCESSING → (RETRYING →) COMPLETED / FAILED
+const (
+	TicketReceived   = "RECEIVED"
+	TicketProcessing = "PROCESSING"
+	TicketRetrying   = "RETRYING"
+	TicketCompleted  = "COMPLETED"
+	TicketFailed     = "FAILED"
+)
+
+func ValidTicketStatus(s string) bool {
+	switch s {
+	case TicketReceived, TicketProcessing, TicketRetrying, TicketCompleted, TicketFailed:
+		return true
+	}
+	return false
+}
+
+// TicketStatus: body pesan di status exchange (REPAIR_STATUS_TRANSACTION).
+type TicketStatus struct {
+	TicketID     string      `json:"ticketId"`
+	SenderNIK    string      `json:"senderNik"`
+	Status       string      `json:"status"`
+	Timestamp    time.Time   `json:"timestamp"`
+	StoreID      string      `json:"storeId,omitempty"`
+	CommandType  CommandType `json:"commandType,omitempty"`
+	Handler      string      `json:"handler,omitempty"`
+	Attempt      int         `json:"attempt,omitempty"`
+	DryRun       bool        `json:"dryRun,omitempty"`
+	ErrorCode    string      `json:"errorCode,omitempty"`
+	ErrorMessage string      `json:"errorMessage,omitempty"`
+	Data         any         `json:"data,omitempty"` // hasil command (mis. ResponseRepairPayment)
+}
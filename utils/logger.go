@@ -12,10 +12,13 @@ import (
 type Logger struct{ *slog.Logger }
 
 // NewLogger: output berwarna, rapi, jam pendek, auto non-color kalau bukan TTY.
-func NewLogger() *Logger {
+func NewLogger() *Logger { return NewLoggerLevel(slog.LevelInfo) }
+
+// NewLoggerLevel: sama dengan NewLogger, level dari config (log.level).
+func NewLoggerLevel(level slog.Level) *Logger {
 	h := tint.NewHandler(os.Stdout, &tint.Options{
-		Level:      slog.LevelInfo, // ubah ke LevelDebug kalau mau lebih rame
-		TimeFormat: "15:04:05",     // 24h; ganti ke "2006-01-02 15:04:05" kalau mau lengkap
+		Level:      level,
+		TimeFormat: "15:04:05", // 24h; ganti ke "2006-01-02 15:04:05" kalau mau lengkap
 		NoColor:    !isatty.IsTerminal(os.Stdout.Fd()),
 	})
 	return &Logger{slog.New(h)}